@@ -0,0 +1,150 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var defaultAdmission []string
+
+// defaultAdmissionFile is the file enabling the --default-admission plugins in the apiserver target directories
+const defaultAdmissionFile = "zz_generated.default_admission.go"
+
+// genericAdmissionPlugins are the admission plugins k8s.io/apiserver registers for every apiserver
+var genericAdmissionPlugins = []string{"MutatingAdmissionWebhook", "NamespaceLifecycle", "ValidatingAdmissionWebhook"}
+
+// admissionRegister matches the registration of an admission plugin by a string literal or constant name
+var admissionRegister = regexp.MustCompile(`\.Register\(\s*(?:"([^"]+)"|(\w+))\s*,`)
+
+// stringConst matches the declaration of a string constant
+var stringConst = regexp.MustCompile(`(\w+)\s*(?:string\s*)?=\s*"([^"]+)"`)
+
+// checkDefaultAdmission exits if a --default-admission plugin is neither registered by
+// k8s.io/apiserver nor by an admission.Plugins Register call of the packages of the module
+func checkDefaultAdmission() {
+	known := map[string]bool{}
+	for _, p := range genericAdmissionPlugins {
+		known[p] = true
+	}
+	c := exec.Command(goBinary(), "list", "-f", "{{ .Dir }}", "./...")
+	c.Env = append(os.Environ(), userEnv()...)
+	c.Stderr = util.Stderr
+	out, err := c.Output()
+	if err != nil {
+		klog.Fatalf("could not list the packages to find the admission plugins of --default-admission: %v", err)
+	}
+	for _, dir := range strings.Fields(string(out)) {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, f := range files {
+			if strings.HasSuffix(f, "_test.go") {
+				continue
+			}
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				klog.Fatalf("could not read %s: %v", f, err)
+			}
+			consts := map[string]string{}
+			for _, m := range stringConst.FindAllStringSubmatch(string(b), -1) {
+				consts[m[1]] = m[2]
+			}
+			for _, m := range admissionRegister.FindAllStringSubmatch(string(b), -1) {
+				if len(m[1]) > 0 {
+					known[m[1]] = true
+				} else if name, found := consts[m[2]]; found {
+					known[name] = true
+				}
+			}
+		}
+	}
+	for _, p := range defaultAdmission {
+		if !known[p] {
+			names := []string{}
+			for n := range known {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			klog.Fatalf("--default-admission %q is not a registered admission plugin, must be one of %q", p, names)
+		}
+	}
+	if !buildApiserver() && len(targetGroups()) == 0 {
+		klog.Warningf("--default-admission has no effect without an %s target", apiserverTarget)
+	}
+}
+
+// generateDefaultAdmission writes the --default-admission plugins into the directory of each apiserver target
+func generateDefaultAdmission() {
+	for _, t := range resolveTargets() {
+		if !isApiserverTarget(t.Name) {
+			continue
+		}
+		generated := filepath.Join(t.Dir, defaultAdmissionFile)
+		klog.Infof("Writing the default admission plugins of %s to %s", t.Name, generated)
+		util.Overwrite(generated, "default-admission-template", defaultAdmissionTemplate, defaultAdmission)
+		recordGenerated(generated)
+	}
+}
+
+var defaultAdmissionTemplate = `// Code generated by apiserver-boot build executables --default-admission. DO NOT EDIT.
+
+package main
+
+import (
+	"sigs.k8s.io/apiserver-runtime/pkg/builder"
+)
+
+func init() {
+	builder.APIServer.WithOptionsFns(enableDefaultAdmission)
+}
+
+// defaultAdmission are the admission plugins enabled unless they are disabled
+// with --disable-admission-plugins
+var defaultAdmission = []string{
+{{- range . }}
+	"{{ . }}",
+{{- end }}
+}
+
+// enableDefaultAdmission adds the defaultAdmission plugins to the plugins enabled by default,
+// after the recommended ones
+func enableDefaultAdmission(o *builder.ServerOptions) *builder.ServerOptions {
+	admission := o.RecommendedOptions.Admission
+	if admission == nil {
+		return o
+	}
+	for _, name := range defaultAdmission {
+		admission.DefaultOffPlugins.Delete(name)
+		found := false
+		for _, p := range admission.RecommendedPluginOrder {
+			found = found || p == name
+		}
+		if !found {
+			admission.RecommendedPluginOrder = append(admission.RecommendedPluginOrder, name)
+		}
+	}
+	return o
+}
+`
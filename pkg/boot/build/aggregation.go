@@ -0,0 +1,158 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var aggregationRoutes []string
+
+// aggregationRoutesFile is the file of the aggregation routes in the apiserver target directories
+const aggregationRoutesFile = "zz_generated.aggregation_routes.go"
+
+// resourceMethod matches the GetGroupVersionResource of the resource.Object types of an API version
+var resourceMethod = regexp.MustCompile(`func \(\w+ \*(\w+)\) GetGroupVersionResource\(\)`)
+
+type aggregationRoute struct {
+	Alias string
+	Path  string
+	Kind  string
+}
+
+type aggregationRoutesTemplateArguments struct {
+	Imports map[string]string
+	Routes  []aggregationRoute
+}
+
+// generateAggregationRoutes writes the routes for the --aggregation-routes resources served by
+// each apiserver target to its directory, and scaffolds the handler they are proxied to
+func generateAggregationRoutes() {
+	kinds := map[string]bool{}
+	for _, api := range versionedAPIs {
+		files, _ := filepath.Glob(filepath.Join("pkg", "apis", api, "*.go"))
+		for _, f := range files {
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				klog.Fatalf("could not read %s: %v", f, err)
+			}
+			for _, m := range resourceMethod.FindAllStringSubmatch(string(b), -1) {
+				kinds[filepath.ToSlash(api)+"/"+m[1]] = true
+			}
+		}
+	}
+	for _, r := range aggregationRoutes {
+		if !kinds[r] {
+			known := []string{}
+			for k := range kinds {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			klog.Fatalf("--aggregation-routes %q is not a resource under pkg/apis, must be one of %q", r, known)
+		}
+	}
+
+	for _, t := range resolveTargets() {
+		if t.Name != apiserverTarget && len(t.Group) == 0 {
+			continue
+		}
+		data := aggregationRoutesTemplateArguments{Imports: map[string]string{}}
+		for _, r := range aggregationRoutes {
+			parts := strings.Split(r, "/")
+			if len(t.Group) > 0 && parts[0] != t.Group {
+				continue
+			}
+			alias := aliasFor(parts[0] + parts[1])
+			data.Imports[alias] = path.Join(util.GetRepo(), "pkg", "apis", parts[0], parts[1])
+			data.Routes = append(data.Routes, aggregationRoute{Alias: alias, Path: r, Kind: parts[2]})
+		}
+		if len(data.Routes) == 0 {
+			continue
+		}
+		generated := filepath.Join(t.Dir, aggregationRoutesFile)
+		klog.Infof("Writing the aggregation routes of %s to %s", t.Name, generated)
+		util.Overwrite(generated, "aggregation-routes-template", aggregationRoutesTemplate, data)
+		recordGenerated(generated)
+		proxy := filepath.Join(t.Dir, "aggregation_proxy.go")
+		if util.WriteIfNotFound(proxy, "aggregation-proxy-template", aggregationProxyTemplate, nil) {
+			klog.Infof("Wrote %s, edit aggregationProxy to delegate the aggregation routes", proxy)
+		}
+	}
+}
+
+var aggregationRoutesTemplate = `// Code generated by apiserver-boot build executables --aggregation-routes. DO NOT EDIT.
+
+package main
+
+import (
+	"net/http"
+	"path"
+
+	"sigs.k8s.io/apiserver-runtime/pkg/builder"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
+{{ range $alias, $path := .Imports }}
+	{{ $alias }} "{{ $path }}"
+{{- end }}
+)
+
+func init() {
+	builder.APIServer.WithServerFns(installAggregationRoutes)
+}
+
+// aggregationRoutes are the resources whose proxy routes are installed into the apiserver
+var aggregationRoutes = []resource.Object{
+{{- range .Routes }}
+	// {{ .Path }}
+	&{{ .Alias }}.{{ .Kind }}{},
+{{- end }}
+}
+
+// installAggregationRoutes serves /apis/<group>/<version>/proxy/<resource>/ with the aggregationProxy of
+// each of the aggregationRoutes, behind the authentication and authorization of the apiserver
+func installAggregationRoutes(s *builder.GenericAPIServer) *builder.GenericAPIServer {
+	for _, obj := range aggregationRoutes {
+		gvr := obj.GetGroupVersionResource()
+		prefix := path.Join("/apis", gvr.Group, gvr.Version, "proxy", gvr.Resource) + "/"
+		s.Handler.NonGoRestfulMux.HandlePrefix(prefix, http.StripPrefix(prefix, aggregationProxy(gvr)))
+	}
+	return s
+}
+`
+
+var aggregationProxyTemplate = `package main
+
+import (
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// aggregationProxy returns the handler of the --aggregation-routes of the resource gvr,
+// e.g. an httputil.ReverseProxy delegating the requests to the backend of the resource.
+// The request path is relative to /apis/<group>/<version>/proxy/<resource>/.
+func aggregationProxy(gvr schema.GroupVersionResource) http.Handler {
+	return http.NotFoundHandler()
+}
+`
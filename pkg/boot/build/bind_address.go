@@ -0,0 +1,81 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var metricsAddr string
+var healthAddr string
+var bindAddressPackage string
+
+// bindAddressFlags returns the import/path.Var=value assignments of --metrics-addr and
+// --health-addr to the metricsBindAddress and healthProbeBindAddress string variables of
+// --bind-address-package, which the controller uses as the defaults of its flags
+func bindAddressFlags() []string {
+	vars := []string{}
+	if len(metricsAddr) > 0 {
+		checkBindAddress("--metrics-addr", metricsAddr)
+		vars = append(vars, bindAddressPackage+".metricsBindAddress="+metricsAddr)
+	}
+	if len(healthAddr) > 0 {
+		checkBindAddress("--health-addr", healthAddr)
+		vars = append(vars, bindAddressPackage+".healthProbeBindAddress="+healthAddr)
+	}
+	return vars
+}
+
+// checkBindAddress exits if addr isn't a [host]:port the controller can listen on, or 0 to
+// disable the endpoint
+func checkBindAddress(flag, addr string) {
+	if addr == "0" {
+		return
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		klog.Fatalf("%s must be of the form [host]:port or 0 to disable the endpoint, got %q: %v", flag, addr, err)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		klog.Fatalf("%s port must be a number from 0 to 65535, got %q", flag, port)
+	}
+	if len(host) > 0 && net.ParseIP(host) == nil && !validHostname(host) {
+		klog.Fatalf("%s host must be an IP address or a hostname, got %q", flag, host)
+	}
+}
+
+// validHostname returns true if host is made of dot separated labels of letters, digits and -
+func validHostname(host string) bool {
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
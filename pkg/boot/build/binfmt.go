@@ -0,0 +1,135 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"runtime"
+)
+
+var verifyPlatform bool
+
+// checkBinaryPlatform returns an error if the executable at path isn't for goos/goarch,
+// e.g. because the environment defeated cross compilation and go built for the host.
+// Architectures without a known header value are only checked for the executable format.
+func checkBinaryPlatform(path, goos, goarch string) error {
+	format, arch, osabi, err := binaryPlatform(path)
+	if err != nil {
+		return fmt.Errorf("could not read the executable header of %s: %v", path, err)
+	}
+	want := "ELF"
+	switch goos {
+	case "darwin", "ios":
+		want = "Mach-O"
+	case "windows":
+		want = "PE"
+	case "plan9", "js", "wasip1", "aix":
+		// not an elf, macho or pe executable, e.g. a wasm module
+		return nil
+	}
+	if format != want || (len(arch) > 0 && arch != goarch) {
+		if len(arch) > 0 {
+			format = arch + " " + format
+		}
+		return fmt.Errorf("%s is built as a %s executable, not for %s/%s", path, format, goos, goarch)
+	}
+	if format == "ELF" && !elfOSABIMatches(osabi, goos) {
+		return fmt.Errorf("%s is built as an ELF executable with OS/ABI %v, not for %s/%s", path, osabi, goos, goarch)
+	}
+	return nil
+}
+
+// binaryPlatform returns the executable format, GOARCH and, for ELF, the OS/ABI of the executable at path
+func binaryPlatform(path string) (string, string, elf.OSABI, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		return "ELF", elfArch(f), f.OSABI, nil
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		return "Mach-O", machoArch[f.Cpu], 0, nil
+	}
+	if f, err := macho.OpenFat(path); err == nil {
+		defer f.Close()
+		return "Mach-O", "", 0, nil
+	}
+	f, err := pe.Open(path)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("not an elf, macho or pe executable")
+	}
+	defer f.Close()
+	return "PE", peArch[f.Machine], 0, nil
+}
+
+// elfOSABI is the EI_OSABI the go linker writes for the GOOS which don't use ELFOSABI_NONE
+var elfOSABI = map[string]elf.OSABI{
+	"freebsd": elf.ELFOSABI_FREEBSD,
+	"netbsd":  elf.ELFOSABI_NETBSD,
+	"openbsd": elf.ELFOSABI_OPENBSD,
+}
+
+// elfOSABIMatches returns true if an ELF executable with the EI_OSABI osabi can be for goos.
+// The external linker may mark linux executables ELFOSABI_LINUX.
+func elfOSABIMatches(osabi elf.OSABI, goos string) bool {
+	if want, found := elfOSABI[goos]; found {
+		return osabi == want
+	}
+	return osabi == elf.ELFOSABI_NONE || osabi == elf.ELFOSABI_LINUX
+}
+
+func elfArch(f *elf.File) string {
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_RISCV:
+		return "riscv64"
+	case elf.EM_PPC64:
+		if f.ByteOrder.String() == "LittleEndian" {
+			return "ppc64le"
+		}
+		return "ppc64"
+	}
+	return ""
+}
+
+var machoArch = map[macho.Cpu]string{
+	macho.CpuAmd64: "amd64",
+	macho.CpuArm64: "arm64",
+}
+
+var peArch = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+}
+
+// crossCompiling returns true if the binaries are built for a platform other than the host
+func crossCompiling() bool {
+	return targetOS() != runtime.GOOS || targetArch() != runtime.GOARCH
+}
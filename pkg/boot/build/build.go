@@ -30,10 +30,20 @@ apiserver-boot build executables
 # Build a container with the apiserver and controller-manager executables
 apiserver-boot build container --image gcr.io/myrepo/myimage:mytag
 
+# List the targets build executables can build
+apiserver-boot build targets
+
+# Write a Makefile reproducing a build with these flags
+apiserver-boot build emit-makefile --goos linux --goarch arm64 --trimpath
+
+# Remove the entries of the go build cache not used in the last week
+apiserver-boot build cache prune --cache-max-age 168h
+
 # Build resource config for running an aggregated apiserver in cluster
 apiserver-boot build config --name nameofservice --namespace mysystemnamespace --image gcr.io/myrepo/myimage:mytag
 	`,
-	Run: RunBuild,
+	PersistentPreRun: SetupLogs,
+	Run:              RunBuild,
 }
 
 func AddBuild(cmd *cobra.Command) {
@@ -43,6 +53,10 @@ func AddBuild(cmd *cobra.Command) {
 	AddBuildContainer(buildCmd)
 	AddBuildResourceConfig(buildCmd)
 	AddDocs(buildCmd)
+	AddBuildTargets(buildCmd)
+	AddEmitMakefile(buildCmd)
+	AddEmitTiltfile(buildCmd)
+	AddCache(buildCmd)
 }
 
 func RunBuild(cmd *cobra.Command, args []string) {
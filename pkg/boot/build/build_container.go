@@ -18,15 +18,40 @@ package build
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
-	"io/ioutil"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
 )
 
 var Image string
+var healthcheckPath string
+var healthcheckInterval time.Duration
+var noHealthcheck bool
+var debugImage bool
+var debugPort int
+var baseImageDigest string
+var entrypointMode string
+var distrolessVariant string
+var layered bool
+
+// containerTargets are the --targets of build container.  They are a variable of their own, as
+// registering the flag writes its default into the variable, which would replace the default
+// targets of build executables.
+var containerTargets []string
+
+// defaultBaseImage is the base image of the Dockerfile without --base-image-digest
+const defaultBaseImage = "ubuntu:14.04"
+
+// distrolessRepo is the repository of the --distroless-variant base images
+const distrolessRepo = "gcr.io/distroless/"
+
+// distrolessVariants are the --distroless-variant values.  debug is base with a busybox shell.
+var distrolessVariants = []string{"static", "base", "debug"}
 
 var createBuildContainerCmd = &cobra.Command{
 	Use:   "container",
@@ -37,7 +62,47 @@ var createBuildContainerCmd = &cobra.Command{
 apiserver-boot build container --image gcr.io/myrepo/myimage:mytag
 
 # Push the newly built image to the image repo
-docker push gcr.io/myrepo/myimage:mytag`,
+docker push gcr.io/myrepo/myimage:mytag
+
+# Check the apiserver /readyz endpoint every 10s instead of /healthz every 30s
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --healthcheck-path /readyz --healthcheck-interval 10s
+
+# Build gcr.io/myrepo/myimage:mytag-debug with an unoptimized apiserver run under
+# delve, listening for a headless debugger on port 2345
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --debug-image
+
+# Write a linux/amd64 and linux/arm64 image index to the OCI layout oci/ without a
+# docker daemon, then push it with crane
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --oci-layout oci --platforms linux/amd64,linux/arm64
+crane push oci gcr.io/myrepo/myimage:mytag
+
+# Build from a base image pinned by digest so the image is reproducible
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --base-image-digest ubuntu@sha256:<digest>
+
+# Build one image running the apiserver, or the controller-manager when run with MODE=controller
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --entrypoint-mode apiserver
+
+# Label the image with the labels of labels.yaml, and override one of them
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --labels-file labels.yaml --label org.opencontainers.image.vendor=example
+
+# Build the image and load it into the kind cluster called dev, without pushing it
+apiserver-boot build container --image example.io/myimage:dev --load-into kind:dev
+
+# Build from gcr.io/distroless/debug, with a busybox shell for troubleshooting
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag-debug --distroless-variant debug
+
+# Build the linux/amd64 image on an arm64 host, registering the qemu emulators first if they aren't
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --setup-qemu
+
+# Build and push a multi-arch image with docker buildx, emulating the platforms the host can't run
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --setup-qemu --platforms linux/amd64,linux/arm64 --push
+
+# Build the binaries into separate layers, so pushing the image after only the controller-manager
+# changed reuses the apiserver layer
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --layered
+
+# Build a minimal image without a HEALTHCHECK
+apiserver-boot build container --image gcr.io/myrepo/myimage:mytag --no-healthcheck`,
 	Run: RunBuildContainer,
 }
 
@@ -48,56 +113,350 @@ func AddBuildContainer(cmd *cobra.Command) {
 
 func AddBuildContainerFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&Image, "image", "", "name of the image with tag")
-	cmd.Flags().StringArrayVar(&BuildTargets, "targets", []string{apiserverTarget, controllerTarget}, "The target binaries to build")
+	cmd.Flags().StringArrayVar(&containerTargets, "targets", []string{apiserverTarget, controllerTarget, migrateTarget}, targetsUsage)
+	cmd.Flags().StringVar(&healthcheckPath, "healthcheck-path", "/healthz", "path on the apiserver secure port checked by the image HEALTHCHECK")
+	cmd.Flags().DurationVar(&healthcheckInterval, "healthcheck-interval", 30*time.Second, "interval between image HEALTHCHECK probes")
+	cmd.Flags().BoolVar(&noHealthcheck, "no-healthcheck", false, "if true, don't add a HEALTHCHECK for the apiserver to the image")
+	cmd.Flags().BoolVar(&debugImage, "debug-image", false, "if true, build the apiserver without optimizations and run it under delve.  The image tag gets a -debug suffix.")
+	cmd.Flags().IntVar(&debugPort, "debug-port", 2345, "port delve listens on in the --debug-image")
+	cmd.Flags().StringVar(&baseImageDigest, "base-image-digest", "", "base image of the image pinned by digest, e.g. ubuntu@sha256:<digest>.  "+
+		"A tag is resolved to its current digest with a warning.  Also used by --oci-layout.")
+	cmd.Flags().StringVar(&ociLayout, "oci-layout", "", "if specified, write the image to this OCI layout directory instead of building it with docker.  "+
+		"The image has no HEALTHCHECK.")
+	cmd.Flags().StringVar(&ociBaseImage, "oci-base-image", distrolessRepo+"static", "base image the binaries are added to for --oci-layout, the --distroless-variant image if it is set")
+	AddDistrolessVariantFlag(cmd)
+	cmd.Flags().StringVar(&entrypointMode, "entrypoint-mode", "", "if specified, build a single image running the apiserver or the controller-manager depending on its MODE environment variable, "+
+		"with this default MODE, apiserver or controller")
+	cmd.Flags().BoolVar(&setupQemu, "setup-qemu", false, "if true, register the qemu emulators with "+binfmtImage+" unless the docker daemon can already run images for the --platforms, "+
+		"and build the image for them with docker buildx, e.g. linux/amd64 on an arm64 host")
+	cmd.Flags().BoolVar(&buildxPush, "push", false, "if true, push the --setup-qemu image with docker buildx instead of loading it into the docker daemon, "+
+		"which building it for more than one of --platforms requires")
+	cmd.Flags().BoolVar(&layered, "layered", false, "if true, add each binary in its own COPY --link layer after the CA certificates, with the labels last, "+
+		"so rebuilding the image after one binary changed reuses the cached layers of the others.  Requires BuildKit.  "+
+		"With --oci-layout, adds each binary in its own layer.")
+	cmd.Flags().StringVar(&loadInto, "load-into", "", "if specified, load the image into this local cluster after building it, kind[:<cluster>] or minikube[:<profile>]")
+	cmd.Flags().StringVar(&labelsFile, "labels-file", "", "if specified, add the labels of this YAML file of label names to values to the image.  "+
+		"They override the labels derived from git, e.g. org.opencontainers.image.revision.")
+	cmd.Flags().StringArrayVar(&imageLabels, "label", []string{}, "KEY=VALUE label to add to the image.  Overrides the --labels-file and git labels.  May be repeated.")
+	cmd.Flags().StringVar(&buildDir, "build-dir", "", "if specified, directory to write the temporary directories and GOCACHE to, e.g. on fast scratch disk")
+	cmd.Flags().BoolVar(&keepTemp, "keep-temp", false, "if true, don't remove the temporary directories of the build and log their locations")
+	cmd.Flags().StringSliceVar(&platforms, "platforms", []string{}, "os/arch platforms to build a multi-arch image index for with --oci-layout or --setup-qemu, defaults to linux/amd64")
+}
+
+// AddDistrolessVariantFlag adds the --distroless-variant flag selecting the base image of the container
+func AddDistrolessVariantFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&distrolessVariant, "distroless-variant", "", "if specified, build the image from this variant of the gcr.io/distroless base image, "+
+		"static, base or debug with a busybox shell for troubleshooting.  Without it the image is built from "+defaultBaseImage+".")
+}
+
+// DistrolessDebug returns true if the image is built from the distroless debug variant, which has a shell
+func DistrolessDebug() bool {
+	return distrolessVariant == "debug"
 }
 
 func RunBuildContainer(cmd *cobra.Command, args []string) {
+	BuildTargets = containerTargets
+	useBuildDir()
 	if len(Image) == 0 {
 		klog.Fatalf("Must specify --image")
 	}
 
-	dir, err := ioutil.TempDir(os.TempDir(), "apiserver-boot-build-container")
+	distroless := len(distrolessVariant) > 0
+	if distroless {
+		valid := false
+		for _, v := range distrolessVariants {
+			valid = valid || v == distrolessVariant
+		}
+		if !valid {
+			klog.Fatalf("--distroless-variant must be one of %q, got %q", distrolessVariants, distrolessVariant)
+		}
+		if len(baseImageDigest) > 0 {
+			klog.Fatalf("--distroless-variant can't be used with --base-image-digest, pin the variant with --base-image-digest %s%s@sha256:<digest>",
+				distrolessRepo, distrolessVariant)
+		}
+		if len(entrypointMode) > 0 {
+			klog.Fatalf("--entrypoint-mode requires a shell in the image and can't be used with --distroless-variant")
+		}
+		if !cmd.Flags().Changed("oci-base-image") {
+			ociBaseImage = distrolessRepo + distrolessVariant
+		}
+	}
+
+	if debugImage {
+		if !buildApiserver() {
+			klog.Fatalf("--debug-image requires the %s target", apiserverTarget)
+		}
+		Image = debugImageName(Image)
+	}
+
+	if len(entrypointMode) > 0 {
+		if entrypointMode != apiserverTarget && entrypointMode != controllerTarget {
+			klog.Fatalf("--entrypoint-mode must be %s or %s, got %q", apiserverTarget, controllerTarget, entrypointMode)
+		}
+		if !buildApiserver() || !buildController() {
+			klog.Fatalf("--entrypoint-mode requires the %s and %s targets", apiserverTarget, controllerTarget)
+		}
+		if debugImage || len(ociLayout) > 0 {
+			klog.Fatalf("--entrypoint-mode can't be used with --debug-image or --oci-layout")
+		}
+	}
+
+	if len(loadInto) > 0 {
+		if len(ociLayout) > 0 {
+			klog.Fatalf("--load-into loads the image from the docker daemon and can't be used with --oci-layout")
+		}
+		checkLoadTarget()
+	}
+
+	if len(ociLayout) > 0 {
+		if setupQemu {
+			klog.Warningf("--setup-qemu has no effect with --oci-layout, which adds the binaries to the image without running it")
+		}
+		buildOCILayout(cmd, args)
+		return
+	}
+	if setupQemu {
+		checkQemuPlatforms()
+	} else if len(platforms) > 0 {
+		klog.Fatalf("--platforms requires --oci-layout or --setup-qemu")
+	}
+	if buildxPush && !setupQemu {
+		klog.Fatalf("--push requires --setup-qemu, push the image with docker push otherwise")
+	}
+
+	dir, err := tempDir(os.TempDir(), "apiserver-boot-build-container")
 	if err != nil {
 		klog.Fatalf("failed to create temp directory %s %v", dir, err)
 	}
 	klog.Infof("Will build docker Image from directory %s", dir)
 
+	healthcheck := buildApiserver() && !noHealthcheck
+	if healthcheck && distroless {
+		klog.Warningf("the distroless images have no curl, building without a HEALTHCHECK")
+		healthcheck = false
+	}
+	if healthcheck {
+		if !strings.HasPrefix(healthcheckPath, "/") {
+			klog.Fatalf("--healthcheck-path %q must start with /", healthcheckPath)
+		}
+		if healthcheckInterval <= 0 {
+			klog.Fatalf("--healthcheck-interval must be positive, got %v", healthcheckInterval)
+		}
+	}
+
 	klog.Infof("Writing the Dockerfile.")
 
+	if len(entrypointMode) > 0 {
+		entrypoint := filepath.Join(dir, "entrypoint.sh")
+		util.WriteIfNotFound(entrypoint, "entrypoint-template", entrypointTemplate, nil)
+		if err := os.Chmod(entrypoint, 0755); err != nil {
+			klog.Fatal(err)
+		}
+	}
+
 	path := filepath.Join(dir, "Dockerfile")
-	util.WriteIfNotFound(path, "dockerfile-template", dockerfileTemplate, dockerfileTemplateArguments{
-		BuildApiserver:  buildApiserver(),
-		BuildController: buildController(),
+	template := dockerfileTemplate
+	if layered {
+		template = layeredDockerfileTemplate
+	}
+	util.WriteIfNotFound(path, "dockerfile-template", template, dockerfileTemplateArguments{
+		BuildApiserver:      buildApiserver(),
+		BuildController:     buildController(),
+		BuildMigrate:        buildMigrate(),
+		Healthcheck:         healthcheck,
+		HealthcheckPath:     healthcheckPath,
+		HealthcheckInterval: healthcheckInterval.String(),
+		Debug:               debugImage,
+		DebugPort:           debugPort,
+		BaseImage:           dockerBaseImage(distroless),
+		Distroless:          distroless,
+		EntrypointMode:      entrypointMode,
+		Labels:              dockerfileLabels(),
+		PlatformDirs:        setupQemu,
 	})
 
-	klog.Infof("Building binaries for linux amd64.")
-
 	// Set the goos and goarch
 	goos = "linux"
 	goarch = "amd64"
+	if setupQemu {
+		// the binaries of each platform are written to <os>_<arch>, which the Dockerfile adds from
+		klog.Infof("Building binaries for %s.", strings.Join(platforms, ", "))
+	} else {
+		klog.Infof("Building binaries for linux amd64.")
+		platforms = nil
+	}
 	outputdir = dir
+	// the Dockerfile adds the binaries by their default names
+	nameTemplate = ""
+	outputTemplate = ""
+	if debugImage {
+		// disable optimizations and inlining so delve can step through the apiserver
+		gcflags = "all=-N -l"
+	}
 	RunBuildExecutables(cmd, args)
 
 	klog.Infof("Building the docker Image using %s.", path)
 
-	util.DoCmd("docker", "build", "-t", Image, dir)
+	build := []string{"build"}
+	if setupQemu {
+		// run the RUN steps of the Dockerfile for the platforms of the binaries, emulated if the daemon is another
+		setupEmulation(platforms)
+		build = buildxArgs()
+	}
+	build = append(build, "-t", Image, dir)
+	if layered {
+		// COPY --link requires BuildKit
+		c := exec.Command("docker", build...)
+		c.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+		klog.Infof("DOCKER_BUILDKIT=1 %s", strings.Join(c.Args, " "))
+		c.Stderr = util.Stderr
+		c.Stdout = util.Stdout
+		if err := c.Run(); err != nil {
+			klog.Fatalf("docker build failed: %v", err)
+		}
+	} else {
+		util.DoCmd("docker", build...)
+	}
+
+	if len(loadInto) > 0 {
+		loadImage(Image)
+	}
+}
+
+// debugImageName returns image with a -debug suffix added to its tag
+func debugImageName(image string) string {
+	if strings.Contains(image, "@") {
+		klog.Fatalf("--debug-image requires --image to be referenced by tag, got %s", image)
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image + "-debug"
+	}
+	return image + ":debug"
 }
 
 type dockerfileTemplateArguments struct {
-	BuildApiserver  bool
-	BuildController bool
+	BuildApiserver      bool
+	BuildController     bool
+	BuildMigrate        bool
+	Healthcheck         bool
+	HealthcheckPath     string
+	HealthcheckInterval string
+	Debug               bool
+	DebugPort           int
+	BaseImage           string
+	Distroless          bool
+	EntrypointMode      string
+	Labels              []string
+	// PlatformDirs is true if the binaries are added from the <os>_<arch> directory of the platform
+	// docker buildx builds the image for
+	PlatformDirs bool
 }
 
 var dockerfileTemplate = `
-FROM ubuntu:14.04
-
+{{ if .Debug }}
+FROM golang:1.17 AS delve
+RUN CGO_ENABLED=0 go install github.com/go-delve/delve/cmd/dlv@v1.8.3
+{{ end }}
+FROM {{ .BaseImage }}
+{{ if .PlatformDirs }}
+ARG TARGETOS
+ARG TARGETARCH
+{{ end }}
+{{ if not .Distroless }}
 RUN apt-get update
-RUN apt-get install -y ca-certificates
+RUN apt-get install -y ca-certificates{{ if .Healthcheck }} curl{{ end }}
+{{ end }}
+{{ range .Labels }}
+LABEL {{ . }}
+{{- end }}
 
 {{ if .BuildApiserver }}
-ADD apiserver .
+ADD {{ if .PlatformDirs }}${TARGETOS}_${TARGETARCH}/{{ end }}apiserver .
+{{ end }}
+{{ if .Healthcheck }}
+HEALTHCHECK --interval={{ .HealthcheckInterval }} CMD {{ if .EntrypointMode }}[ "$MODE" != apiserver ] || {{ end }}curl -fsk https://localhost:443{{ .HealthcheckPath }} || exit 1
+{{ end }}
+{{ if .BuildController }}
+ADD {{ if .PlatformDirs }}${TARGETOS}_${TARGETARCH}/{{ end }}controller-manager .
+{{ end }}
+{{ if .BuildMigrate }}
+# run by an init container with command ./migrate before the apiserver starts
+ADD {{ if .PlatformDirs }}${TARGETOS}_${TARGETARCH}/{{ end }}migrate .
+{{ end }}
+{{ if .EntrypointMode }}
+ADD entrypoint.sh .
+ENV MODE={{ .EntrypointMode }}
+ENTRYPOINT ["./entrypoint.sh"]
+{{ end }}
+{{ if .Debug }}
+COPY --from=delve /go/bin/dlv .
+EXPOSE {{ .DebugPort }}
+ENTRYPOINT ["./dlv", "--listen=:{{ .DebugPort }}", "--headless=true", "--api-version=2", "--accept-multiclient", "exec", "./apiserver", "--"]
+{{ end }}
+`
+
+// layeredDockerfileTemplate is the --layered Dockerfile.  The layers are ordered from the least to
+// the most often changed: the base image and CA certificates, the image configuration, the
+// entrypoint and delve, then a layer for each binary, and the labels, which change with each
+// commit, last.  COPY --link makes each binary layer independent of the layers before it, so
+// BuildKit reuses the cached layer of an unchanged binary even if another binary changed.
+var layeredDockerfileTemplate = `# syntax=docker/dockerfile:1.4
+{{ if .Debug }}
+FROM golang:1.17 AS delve
+RUN CGO_ENABLED=0 go install github.com/go-delve/delve/cmd/dlv@v1.8.3
+{{ end }}
+FROM {{ .BaseImage }}
+{{ if .PlatformDirs }}
+ARG TARGETOS
+ARG TARGETARCH
+{{ end }}
+{{ if not .Distroless }}
+RUN apt-get update && apt-get install -y ca-certificates{{ if .Healthcheck }} curl{{ end }}
+{{ end }}
+{{ if .Healthcheck }}
+HEALTHCHECK --interval={{ .HealthcheckInterval }} CMD {{ if .EntrypointMode }}[ "$MODE" != apiserver ] || {{ end }}curl -fsk https://localhost:443{{ .HealthcheckPath }} || exit 1
+{{ end }}
+{{ if .EntrypointMode }}
+ENV MODE={{ .EntrypointMode }}
+ENTRYPOINT ["./entrypoint.sh"]
+COPY --link entrypoint.sh .
+{{ end }}
+{{ if .Debug }}
+EXPOSE {{ .DebugPort }}
+ENTRYPOINT ["./dlv", "--listen=:{{ .DebugPort }}", "--headless=true", "--api-version=2", "--accept-multiclient", "exec", "./apiserver", "--"]
+COPY --link --from=delve /go/bin/dlv .
+{{ end }}
+{{ if .BuildMigrate }}
+# run by an init container with command ./migrate before the apiserver starts
+COPY --link {{ if .PlatformDirs }}${TARGETOS}_${TARGETARCH}/{{ end }}migrate .
 {{ end }}
 {{ if .BuildController }}
-ADD controller-manager .
+COPY --link {{ if .PlatformDirs }}${TARGETOS}_${TARGETARCH}/{{ end }}controller-manager .
+{{ end }}
+{{ if .BuildApiserver }}
+COPY --link {{ if .PlatformDirs }}${TARGETOS}_${TARGETARCH}/{{ end }}apiserver .
 {{ end }}
+{{ range .Labels }}
+LABEL {{ . }}
+{{- end }}
+`
+
+// entrypointTemplate runs the binary selected by MODE in the --entrypoint-mode image
+var entrypointTemplate = `#!/bin/sh
+case "$MODE" in
+apiserver) exec ./apiserver "$@" ;;
+controller) exec ./controller-manager "$@" ;;
+*) echo "MODE must be apiserver or controller, got '$MODE'" >&2; exit 1 ;;
+esac
 `
+
+// dockerBaseImage returns the base image for the Dockerfile FROM, the --distroless-variant image if distroless
+func dockerBaseImage(distroless bool) string {
+	if distroless {
+		return distrolessRepo + distrolessVariant
+	}
+	if len(baseImageDigest) == 0 {
+		return defaultBaseImage
+	}
+	return pinnedBaseImage()
+}
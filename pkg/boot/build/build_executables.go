@@ -17,26 +17,98 @@ limitations under the License.
 package build
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
 )
 
 var goos = "linux"
 var goarch = "amd64"
 var outputdir = "bin"
+var outputBase string
 var Bazel bool
 var Gazelle bool
+var bazelNoCopy bool
+var bazelFlags []string
+var reposFile string
+var reposMacro string
+var noUpdateRepos bool
 var BuildTargets []string
+var buildMode string
+var modMode string
+var trimpath bool
+var respectCgoEnv bool
+var compileParallelism int
+var pluginPackage string
+var gcflags string
+var asmflags string
+var ldflags string
+var nameTemplate string
+var outputTemplate string
+var requireClean bool
+var buildTimeout time.Duration
+var targetTimeout time.Duration
+var keepGoing bool
+var strict bool
+var casDir string
+var printPlan bool
+var race bool
+var goBin string
+var platforms []string
+var since string
+
+// maxGazelleDirs is the number of changed directories above which --since runs gazelle on
+// the whole repo rather than on each changed directory
+const maxGazelleDirs = 50
+
+// artifact is a file produced by build executables
+type artifact struct {
+	// Target is the name of the target the artifact was built for
+	Target string
+	// Path is the location the artifact was written to
+	Path string
+	// OS and Arch are the platform the artifact was built for
+	OS   string
+	Arch string
+}
+
+// artifacts are the files produced by the current build
+var artifacts []artifact
+
+// stageDir is the private directory go build writes the binaries to before
+// they are moved into the output directory, and staged are the binaries in it
+var stageDir string
+var staged []artifact
+
+// goOnlyFlags are the flags of build executables which have no effect with --bazel
+var goOnlyFlags = []string{
+	"goos", "goarch", "platforms", "output", "output-base", "go-bin", "skip-platform-check", "verify-platform", "buildmode", "mod", "trimpath", "compile-parallelism", "build-trace", "cc-map", "cgo-cflags", "cgo-ldflags", "respect-cgo-env", "goproxy", "goproxy-off", "runtime-replace", "fips", "plugin-package", "env", "env-file", "name-template", "output-template",
+	"ldflags", "ldflags-file", "strip", "gcflags", "asmflags", "timeout", "timeout-per-target", "keep-going", "incremental",
+}
 
 const (
 	apiserverTarget  = "apiserver"
 	controllerTarget = "controller"
+	migrateTarget    = "migrate"
+	testTarget       = "test-binaries"
+	kubectlPlugin    = "kubectl-plugin"
+
+	targetsUsage = "The target binaries to build.  apiserver:<group> builds an apiserver for a single API group from cmd/apiserver-<group>.  Run build targets to list them.  " +
+		"- reads newline separated targets from stdin."
 )
 
 var createBuildExecutablesCmd = &cobra.Command{
@@ -54,8 +126,247 @@ apiserver-boot build executables --goos linux --goarch amd64 --output linux/
 # Must first install bazel and gazelle !!!
 apiserver-boot build executables --bazel --gazelle
 
+# Only regenerate the BUILD files of the directories changed since origin/master
+apiserver-boot build executables --bazel --gazelle --since origin/master
+
+# Write the go_repository rules to the go_deps macro of bazel/deps.bzl
+apiserver-boot build executables --bazel --gazelle --repos-file bazel/deps.bzl --repos-macro go_deps
+
+# Regenerate the BUILD files but not the hand maintained go_repository rules of repos.bzl
+apiserver-boot build executables --bazel --gazelle --no-update-repos
+
 # Run Bazel without generating BUILD files
 apiserver-boot build executables --bazel
+
+# Build with bazel and print the paths of the binaries in bazel-bin instead of copying them to bin/
+apiserver-boot build executables --bazel --no-copy
+
+# Share the action outputs between workspaces for fast iterative builds.  Don't run
+# bazel clean --expunge between builds, it discards the analysis cache of the bazel server.
+apiserver-boot build executables --bazel --bazel-flag=--disk_cache=$HOME/.cache/bazel-disk
+
+# Copy the built UI from web/dist into pkg/ui/assets where the apiserver go:embeds it
+apiserver-boot build executables --embed-dir web/dist=pkg/ui/assets
+
+# Fail the build if the apiserver crashes on startup, e.g. from a panic in an init()
+apiserver-boot build executables --smoke-test
+
+# Fail the build if the OpenAPI documents the apiserver serves don't load, printing the schemas which don't
+apiserver-boot build executables --verify-openapi
+
+# Install the routes proxying /apis/storage.example.com/v1/proxy/volumes/ to the aggregationProxy
+# scaffolded in cmd/apiserver/aggregation_proxy.go
+apiserver-boot build executables --aggregation-routes storage/v1/Volume
+
+# Write the objects of the storage API group to etcd as storage/v1beta1, failing the build
+# if pkg/apis/storage/v1beta1 doesn't exist
+apiserver-boot build executables --storage-version storage/v1beta1
+
+# Enable the BanFlunder admission plugin registered by the project by default, which
+# --disable-admission-plugins can still turn off
+apiserver-boot build executables --default-admission BanFlunder
+
+# Review what would be built, and how, without building anything
+apiserver-boot build executables --plan
+
+# Write the go build commands and their environment to build.sh to reproduce the build without apiserver-boot
+apiserver-boot build executables --emit-script build.sh --plan
+
+# Print why each target is built or skipped, e.g. skipped: no cmd/migrate/main.go
+apiserver-boot build executables --explain --plan
+
+# Print the environment go build runs with for each target, e.g. to debug cross compiling
+apiserver-boot build executables --print-env --goos linux --goarch arm64 --plan
+
+# Also generate config/crds/ for the types served as CRDs instead of by the apiserver
+apiserver-boot build executables --with-crds
+
+# Regenerate the generated.proto and generated.pb.go files of the API versions before building
+apiserver-boot build executables --with-proto --protoc /usr/local/bin/protoc
+
+# Fail if converting between the API versions loses fields, e.g. after adding a field to v1beta1 only
+apiserver-boot build executables --with-conversion-fuzz
+
+# Fail if a type of the API versions, e.g. a new kind, isn't registered in the scheme
+apiserver-boot build executables --verify-scheme
+
+# Fail if the checked-in zz_generated files are out of date with the types, e.g. in CI
+apiserver-boot build executables --verify-generated
+
+# List, then remove, the generated files left behind, e.g. the zz_generated files of a removed API version
+apiserver-boot build executables --prune-generated
+
+# Fail if config/rbac/role.yaml doesn't grant the permissions of the +kubebuilder:rbac markers of the controllers
+apiserver-boot build executables --verify-rbac
+
+# Save the build log as an artifact in CI while still streaming it to the console
+apiserver-boot build executables --log-file build.log
+
+# Also store the binaries as cas/<sha256> and map their names to digests in cas/manifest.json
+apiserver-boot build executables --cas-dir cas
+
+# Keep the go build cache and the content addressed store of a long-lived CI runner under 20GiB,
+# removing the entries not used in the last two weeks
+apiserver-boot build executables --cas-dir /var/cache/apiserver-builds --cache-max-size 20GiB --cache-max-age 336h
+
+# Skip relinking the binaries whose sources, dependencies, flags, environment and go version are
+# unchanged since the last --incremental build, e.g. when only the controller changed
+apiserver-boot build executables --incremental
+
+# Build the init container binary running the migrations before the apiserver starts from cmd/migrate
+apiserver-boot build executables --targets apiserver,migrate
+
+# Build the kubectl plugin of cmd/kubectl-plugin for each platform into tar.gz archives, and write a krew
+# manifest installing them from the GitHub release of the version
+apiserver-boot build executables --targets kubectl-plugin --platforms linux/amd64,darwin/arm64,windows/amd64 \
+    --krew-manifest plugin.yaml --krew-plugin-name example --krew-short-description "Manage the example.io resources" \
+    --krew-uri-template 'https://github.com/example/example/releases/download/{{.Version}}/{{.Archive}}'
+
+# Build a release from a source tree exported with git archive, which has no git metadata
+git archive --format=tar v1.2.0 | tar -x -C /tmp/release
+cd /tmp/release && apiserver-boot build executables --source-version v1.2.0 --ldflags "-X main.version={{ .Version }}"
+
+# Build race instrumented test binaries of the packages under pkg/ into bin/tests, and the
+# servers without the race detector.  Building the test binaries of several packages at once requires go 1.21.
+apiserver-boot build executables --targets apiserver,controller,test-binaries --race
+
+# Check the apiserver compiles against the k8s.io libraries of kubernetes 1.22 and 1.23
+apiserver-boot build executables --k8s-matrix v0.22.8,v0.23.5
+
+# Build a staging apiserver serving net/http/pprof on the PPROF_ADDRESS, localhost:6060 by default
+apiserver-boot build executables --with-pprof
+
+# Fail before building if there is less than 10Gi free for the binaries or the go build cache
+apiserver-boot build executables --min-disk 10Gi --strict
+
+# Fail if the stripped binaries grow over 60MiB, or 80MiB for the apiserver
+apiserver-boot build executables --strip --max-size 60MiB --max-size-apiserver 80MiB
+
+# Keep the temporary directories, GOCACHE and the bazel output base on the scratch disk of a CI runner,
+# and clean up with a single rm -rf
+apiserver-boot build executables --build-dir /scratch/apiserver-boot
+
+# Write bin/apiserver.spdx.json and bin/controller-manager.spdx.json SBOMs of the binaries
+apiserver-boot build executables --sbom --sbom-format spdx
+
+# Record the binaries built for every platform in a manifest for the release automation
+apiserver-boot build executables --platforms linux/amd64,linux/arm64 --manifest manifest.yaml --manifest-format yaml
+
+# Export a trace of the build to the OpenTelemetry collector listening on localhost:4317
+apiserver-boot build executables --otel-endpoint localhost:4317 --otel-insecure
+
+# Fail the build if the binaries call a function with a known vulnerability
+apiserver-boot build executables --vulncheck
+
+# Fail if go.mod requires modules the binaries don't use
+apiserver-boot build executables --prune-modules --strict
+
+# Build an apiserver per API group from cmd/apiserver-foo and cmd/apiserver-bar
+apiserver-boot build executables --targets apiserver:foo,apiserver:bar
+
+# Name the binaries like goreleaser, e.g. bin/apiserver_v1.0.0_linux_arm64
+apiserver-boot build executables --goos linux --goarch arm64 --name-template '{{.Target}}_{{.Version}}_{{.OS}}_{{.Arch}}'
+
+# Group the release binaries by binary and platform, e.g. dist/apiserver/linux-arm64/apiserver
+apiserver-boot build executables --platforms linux/amd64,linux/arm64 --output dist --output-template '{{.Target}}/{{.OS}}-{{.Arch}}'
+
+# Build for linux and darwin into bin/linux_amd64/ and bin/darwin_arm64/, stamping the platform
+# into the version string of each binary
+apiserver-boot build executables --platforms linux/amd64,darwin/arm64 \
+    --ldflags '-X main.version={{.Version}}-{{.OS}}-{{.Arch}}'
+
+# Build with the go toolchain of the golang:1.17.8 image instead of the host one
+apiserver-boot build executables --in-container --builder-image golang:1.17.8
+
+# Stamp the version variables of the package example.io/pkg/version with the git describe version
+apiserver-boot build executables --version-package example.io/pkg/version
+
+# Store the objects of this apiserver under /registry/tenant-a in etcd unless it is run with --etcd-prefix
+apiserver-boot build executables --etcd-prefix /registry/tenant-a
+
+# Build the alpha channel of the apiserver, enabling the AlphaThing gate declared in pkg/features by default
+apiserver-boot build executables --feature-gates AlphaThing=true,BetaThing=true
+
+# Default the leader election of the controller to a 30s lease renewed every 20s, retried every 5s
+apiserver-boot build executables --leader-election lease-duration=30s,renew-deadline=20s,retry-period=5s
+
+# Default the controller to serve metrics on :8443 and the health probes on :8444
+apiserver-boot build executables --metrics-addr :8443 --health-addr :8444
+
+# Set the version variables listed as import/path.Var=value lines in hack/version.ldflags,
+# with the -X in --ldflags overriding the file
+apiserver-boot build executables --ldflags-file hack/version.ldflags --ldflags '-X main.commit=abc123'
+
+# Build in an air-gapped environment fetching modules only from an internal proxy
+apiserver-boot build executables --goproxy https://goproxy.internal.example.com
+
+# Build without any network access from the vendor directory
+apiserver-boot build executables --offline --mod vendor
+
+# Build binaries which are byte for byte identical on other machines building the same commit
+apiserver-boot build executables --trimpath
+
+# Build the controller-manager before the apiserver
+apiserver-boot build executables --order controller,apiserver
+
+# Build only the targets with changes since origin/master
+apiserver-boot build targets --changed --since origin/master | apiserver-boot build executables --targets -
+
+# Build the apiserver with cgo too, e.g. to use the system DNS resolver
+CGO_ENABLED=1 apiserver-boot build executables --respect-cgo-env
+
+# Build WASI modules, written to bin/apiserver.wasm and bin/controller-manager.wasm
+apiserver-boot build executables --goos wasip1 --goarch wasm
+
+# Cross compile with cgo using a gcc cross compiler for each platform
+CGO_ENABLED=1 apiserver-boot build executables --respect-cgo-env --platforms linux/amd64,linux/arm64 \
+    --cc-map linux/arm64=aarch64-linux-gnu-gcc
+
+# Build the controller-manager with cgo against the headers and libraries vendored in third_party/
+CGO_ENABLED=1 apiserver-boot build executables --targets controller \
+    --cgo-cflags "-I$PWD/third_party/include" --cgo-ldflags "-L$PWD/third_party/lib"
+
+# Build apiservers using the FIPS validated BoringCrypto module for regulated deployments
+apiserver-boot build executables --fips --goos linux --goarch amd64
+
+# Replace the binaries in bin even though bin is a symlink to a shared directory
+apiserver-boot build executables --follow-symlinks
+
+# Build against a local checkout of apiserver-runtime without editing go.mod
+apiserver-boot build executables --runtime-replace ../apiserver-runtime
+
+# Compile at most 2 packages at a time on a runner with little memory
+apiserver-boot build executables --compile-parallelism 2
+
+# Find the packages which take longest to compile from the trace of go build, see docs/running_locally.md
+apiserver-boot build executables --targets apiserver --build-trace trace.json
+
+# Write the binaries to bin/ of the project from a subdirectory of the project
+apiserver-boot build executables --output-base project-root
+
+# Build with a specific go installation instead of the go on the PATH
+apiserver-boot build executables --go-bin /usr/local/go1.17/bin/go
+
+# Build without optimizations and inlining for debugging
+apiserver-boot build executables --gcflags 'all=-N -l'
+
+# Give up on a hung target after 10 minutes, but still build the others
+apiserver-boot build executables --timeout-per-target 10m --keep-going
+
+# Fail if regenerating the protobuf code takes longer than 5 minutes, separately from compiling
+apiserver-boot build executables --with-proto --generate-timeout 5m
+
+# Only regenerate the protobuf code when the API types changed since the last build
+apiserver-boot build executables --with-proto --generate-if-stale
+
+# Release build which refuses to build uncommitted changes
+apiserver-boot build executables --require-clean
+
+# Build with cgo compiler settings kept in a dotenv file, overriding one of them
+apiserver-boot build executables --env-file build.env --env CC=clang
+
+# Build the package under plugin/admission as a Go plugin into bin/admission.so
+apiserver-boot build executables --buildmode plugin --plugin-package ./plugin/admission
 `,
 	Run: RunBuildExecutables,
 }
@@ -67,182 +378,1006 @@ func AddBuildExecutables(cmd *cobra.Command) {
 	createBuildExecutablesCmd.Flags().StringVar(&goos, "goos", "", "if specified, set this GOOS")
 	createBuildExecutablesCmd.Flags().StringVar(&goarch, "goarch", "", "if specified, set this GOARCH")
 	createBuildExecutablesCmd.Flags().StringVar(&outputdir, "output", "bin", "if set, write the binaries to this directory")
+	createBuildExecutablesCmd.Flags().StringVar(&outputBase, "output-base", "cwd", "directory a relative --output is resolved against, cwd or project-root for the closest directory containing a go.mod")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&platforms, "platforms", []string{}, "if specified, build for each of these os/arch platforms instead of --goos and --goarch.  "+
+		"The binaries for each platform are written to <output>/<os>_<arch>/")
 	createBuildExecutablesCmd.Flags().BoolVar(&Bazel, "bazel", false, "if true, use bazel to build.  May require updating build rules with gazelle.")
+	createBuildExecutablesCmd.Flags().BoolVar(&bazelNoCopy, "no-copy", false, "if true, leave the binaries built by --bazel in bazel-bin and print their paths instead of copying them to bin/")
+	createBuildExecutablesCmd.Flags().StringArrayVar(&bazelFlags, "bazel-flag", []string{}, "flag passed to each bazel command of --bazel, e.g. --bazel-flag=--disk_cache=~/.cache/bazel-disk.  May be repeated.")
 	createBuildExecutablesCmd.Flags().BoolVar(&Gazelle, "gazelle", false, "if true, run gazelle before running bazel.")
-	createBuildExecutablesCmd.Flags().StringArrayVar(&BuildTargets, "targets", []string{apiserverTarget, controllerTarget}, "The target binaries to build")
+	createBuildExecutablesCmd.Flags().StringVar(&reposFile, "repos-file", "repos.bzl", "file --gazelle writes the go_repository rules for go.mod to")
+	createBuildExecutablesCmd.Flags().BoolVar(&noUpdateRepos, "no-update-repos", false, "if true, don't run gazelle update-repos with --gazelle, e.g. if --repos-file is maintained by hand")
+	createBuildExecutablesCmd.Flags().StringVar(&reposMacro, "repos-macro", "go_repositories", "macro in --repos-file --gazelle writes the go_repository rules for go.mod to")
+	createBuildExecutablesCmd.Flags().StringVar(&since, "since", "", "if specified with --gazelle, only run gazelle on the directories changed since this git ref")
+	createBuildExecutablesCmd.Flags().StringArrayVar(&BuildTargets, "targets", []string{apiserverTarget, controllerTarget, migrateTarget, kubectlPlugin}, targetsUsage)
+	createBuildExecutablesCmd.Flags().StringSliceVar(&buildOrder, "order", []string{}, "the order the targets are built in, e.g. controller,apiserver.  "+
+		"Targets it doesn't list are built after them in the --targets order.")
+	createBuildExecutablesCmd.Flags().StringVar(&buildMode, "buildmode", "", "if specified, pass this -buildmode to go build.  With \"plugin\", build --plugin-package into a .so instead of the targets.")
+	createBuildExecutablesCmd.Flags().StringVar(&envFile, "env-file", "", "if specified, read KEY=VALUE lines from this file into the go build environment.  Lines starting with # are ignored.")
+	createBuildExecutablesCmd.Flags().StringArrayVar(&buildEnv, "env", []string{}, "KEY=VALUE to set in the go build environment.  Overrides values from --env-file.")
+	createBuildExecutablesCmd.Flags().StringVar(&nameTemplate, "name-template", "", "if specified, go template for the binary file names.  "+
+		"Supports {{.Target}}, {{.Version}}, {{.OS}} and {{.Arch}}, e.g. {{.Target}}_{{.Version}}_{{.OS}}_{{.Arch}}")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&aggregationRoutes, "aggregation-routes", []string{}, "if specified, generate the routes proxying /apis/<group>/<version>/proxy/<resource>/ "+
+		"of these <group>/<version>/<Kind> resources under pkg/apis to the aggregationProxy of each apiserver target")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&storageVersions, "storage-version", []string{}, "if specified, the <group>/<version> under pkg/apis the apiserver targets write the objects of the API group to etcd in.  "+
+		"Fails the build if the version isn't registered.")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&defaultAdmission, "default-admission", []string{}, "if specified, admission plugins the apiserver targets enable by default after the recommended ones.  "+
+		"Fails the build unless they are registered by k8s.io/apiserver or an admission.Plugins Register call of the project.")
+	createBuildExecutablesCmd.Flags().StringVar(&outputTemplate, "output-template", "", "if specified, go template for the directory under --output each binary is written to instead of <os>_<arch>/ with --platforms.  "+
+		"Supports the --name-template variables, e.g. {{.Target}}/{{.OS}}-{{.Arch}}")
+	createBuildExecutablesCmd.Flags().BoolVar(&requireClean, "require-clean", false, "if true, fail if the git working tree has uncommitted changes.  Use for release builds.")
+	createBuildExecutablesCmd.Flags().BoolVar(&skipPlatformCheck, "skip-platform-check", false, "if true, don't check the platforms being built for are listed by go tool dist list")
+	createBuildExecutablesCmd.Flags().StringVar(&modMode, "mod", "", "if specified, pass this -mod to go build, one of readonly, vendor or mod.  "+
+		"--mod vendor builds with GOPROXY=off.")
+	createBuildExecutablesCmd.Flags().StringVar(&runtimeReplace, "runtime-replace", "", "if specified, build with "+runtimeModule+" replaced by the checkout in this directory, "+
+		"using a copy of go.mod and go.sum so go.mod is left as is even if the build fails")
+	createBuildExecutablesCmd.Flags().IntVar(&compileParallelism, "compile-parallelism", 0, "if positive, pass -p to go build to limit the programs it runs in parallel, e.g. to avoid running out of memory.  "+
+		"The targets are built one at a time, so this bounds the whole build.")
+	createBuildExecutablesCmd.Flags().StringVar(&buildTrace, "build-trace", "", "if specified, pass -debug-trace to go build to write a trace of the compilation of each package to this file, "+
+		"viewable in chrome://tracing or https://ui.perfetto.dev.  With more than one target or platform, the traces are written to <name>-<target>-<os>-<arch>.json.")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&ccMap, "cc-map", []string{}, "os/arch=compiler entries setting CC, and CXX for gcc and clang, when building for os/arch with cgo.  "+
+		"Ignored for the targets built without cgo.")
+	createBuildExecutablesCmd.Flags().StringVar(&cgoCflags, "cgo-cflags", "", "if specified, add these flags to the CGO_CFLAGS of the targets built with cgo, e.g. -I for vendored headers.  "+
+		"Appended to the CGO_CFLAGS from --env, --env-file or the environment.")
+	createBuildExecutablesCmd.Flags().StringVar(&cgoLdflags, "cgo-ldflags", "", "if specified, add these flags to the CGO_LDFLAGS of the targets built with cgo, e.g. -L for vendored libraries.  "+
+		"Appended to the CGO_LDFLAGS from --env, --env-file or the environment.")
+	createBuildExecutablesCmd.Flags().BoolVar(&respectCgoEnv, "respect-cgo-env", false, "if true, build every target with the CGO_ENABLED from the environment if it is set.  "+
+		"By default only the controller-manager does, and the apiserver is built with CGO_ENABLED=0.")
+	createBuildExecutablesCmd.Flags().BoolVar(&trimpath, "trimpath", false, "if true, build with -trimpath and -trimpath in GOFLAGS so the source and module cache paths aren't in the binaries, "+
+		"making them reproducible on machines with a different GOPATH or GOMODCACHE")
+	createBuildExecutablesCmd.Flags().StringVar(&goproxy, "goproxy", "", "if specified, build with this GOPROXY instead of the one from the environment")
+	createBuildExecutablesCmd.Flags().BoolVar(&offline, "offline", false, "if true, build without network access: with GOPROXY=off, GOSUMDB=off and GOTOOLCHAIN=local, "+
+		"failing before building if a module is missing from the module cache, and refusing the flags which need the network, e.g. --vulncheck.  Combine with --mod vendor for a hermetic build.")
+	createBuildExecutablesCmd.Flags().BoolVar(&goproxyOff, "goproxy-off", false, "if true, build with GOPROXY=off so modules missing from the module cache fail the build")
+	createBuildExecutablesCmd.Flags().BoolVar(&verifyPlatform, "verify-platform", true, "if true, fail if a cross compiled binary isn't an executable for the target platform")
+	createBuildExecutablesCmd.Flags().StringVar(&goBin, "go-bin", "", "path of the go binary to build with.  Defaults to $GO, or go from the PATH.")
+	createBuildExecutablesCmd.Flags().StringVar(&ldflags, "ldflags", "", "if specified, pass this -ldflags to go build.  Ignored with --bazel.  "+
+		"Supports the same template variables as --name-template, rendered for each target and platform.")
+	createBuildExecutablesCmd.Flags().StringVar(&ldflagsFile, "ldflags-file", "", "if specified, pass a -X to go build for each import/path.Var=value line of this file.  "+
+		"Merged before --ldflags, so --ldflags wins.  Unlike --ldflags, the values aren't templates.  Ignored with --bazel.")
+	createBuildExecutablesCmd.Flags().StringVar(&gcflags, "gcflags", "", "if specified, pass this -gcflags to go build.  Ignored with --bazel.")
+	createBuildExecutablesCmd.Flags().StringVar(&asmflags, "asmflags", "", "if specified, pass this -asmflags to go build.  Ignored with --bazel.")
+	createBuildExecutablesCmd.Flags().DurationVar(&buildTimeout, "timeout", 0, "if non-zero, fail if go building all of the targets takes longer than this")
+	createBuildExecutablesCmd.Flags().DurationVar(&generateTimeout, "generate-timeout", 0, "if non-zero, fail if the code generation before building, e.g. of --with-proto and --with-crds, "+
+		"takes longer than this.  Not included in --timeout.")
+	createBuildExecutablesCmd.Flags().BoolVar(&generateIfStale, "generate-if-stale", false, "if true, only run the code generation if a file under pkg/apis or hack/boilerplate.go.txt "+
+		"changed, or the generation flags differ, since it last ran.  Recorded in "+generateStampName+" in --output.")
+	createBuildExecutablesCmd.Flags().DurationVar(&targetTimeout, "timeout-per-target", 0, "if non-zero, fail a target if go building it takes longer than this")
+	createBuildExecutablesCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "if true, continue building the remaining targets after a target fails")
+	createBuildExecutablesCmd.Flags().BoolVar(&incremental, "incremental", false, "if true, skip building the targets whose binary in the output directory was built with --incremental "+
+		"from the same sources, dependencies, build flags, go env and go version")
+	createBuildExecutablesCmd.Flags().BoolVar(&withCRDs, "with-crds", false, "if true, generate CRD manifests with controller-gen for the API versions with +kubebuilder:resource types")
+	createBuildExecutablesCmd.Flags().BoolVar(&withProto, "with-proto", false, "if true, generate the protobuf of the API versions with go-to-protobuf before building")
+	createBuildExecutablesCmd.Flags().BoolVar(&withConversionFuzz, "with-conversion-fuzz", false, "if true, fail if fuzzed objects of the kinds served by more than one API version "+
+		"don't round trip through the conversions between the versions")
+	createBuildExecutablesCmd.Flags().BoolVar(&verifyScheme, "verify-scheme", false, "if true, fail listing the types of the API versions embedding metav1.TypeMeta "+
+		"which aren't registered in the scheme by their AddToScheme, or by apiserver-runtime for the resources")
+	createBuildExecutablesCmd.Flags().StringVar(&protocPath, "protoc", "protoc", "protoc binary --with-proto runs go-to-protobuf with")
+	createBuildExecutablesCmd.Flags().StringVar(&crdDir, "crd-dir", filepath.Join("config", "crds"), "directory to write the CRD manifests generated by --with-crds")
+	createBuildExecutablesCmd.Flags().BoolVar(&verifyGenerated, "verify-generated", false, "if true, regenerate the deepcopy code of the API versions with controller-gen into a temporary directory "+
+		"and fail listing the checked-in generated files which are out of date")
+	createBuildExecutablesCmd.Flags().BoolVar(&reportUnusedGenerated, "report-unused-generated", false, "if true, warn listing the generated files the code generation no longer writes: "+
+		"the apiserver-boot zz_generated files of the target directories for flags which aren't set, and the generated files of the directories under pkg/apis without types")
+	createBuildExecutablesCmd.Flags().BoolVar(&pruneGenerated, "prune-generated", false, "if true, remove the files listed by --report-unused-generated after listing them")
+	createBuildExecutablesCmd.Flags().BoolVar(&fips, "fips", false, "if true, build linux/amd64 binaries linked with BoringCrypto, with GOEXPERIMENT=boringcrypto and CGO_ENABLED=1, "+
+		"and fail if go tool nm doesn't find its symbols in the binaries")
+	createBuildExecutablesCmd.Flags().BoolVar(&followSymlinks, "follow-symlinks", false, "if true, remove and install the binaries under bin through symlinked directories, replacing the files they link to.  "+
+		"By default the build fails before installing through them.")
+	createBuildExecutablesCmd.Flags().BoolVar(&verifyRBAC, "verify-rbac", false, "if true, regenerate the roles of the +kubebuilder:rbac markers with controller-gen into a temporary directory "+
+		"and fail listing the rules missing from or extra in --rbac-role")
+	createBuildExecutablesCmd.Flags().StringVar(&rbacRoleFile, "rbac-role", filepath.Join("config", "rbac", "role.yaml"), "checked-in role manifest --verify-rbac compares the generated roles with")
+	createBuildExecutablesCmd.Flags().StringVar(&rbacRoleName, "rbac-role-name", "manager-role", "name of the ClusterRole --verify-rbac generates")
+	createBuildExecutablesCmd.Flags().StringVar(&rbacPaths, "rbac-paths", "./...", "packages --verify-rbac reads the +kubebuilder:rbac markers of")
+	createBuildExecutablesCmd.Flags().StringVar(&githubOutput, "github-output", "", "file to append an artifact_<target>=<path> step output for each binary to.  Defaults to $GITHUB_OUTPUT in GitHub Actions.")
+	createBuildExecutablesCmd.Flags().StringVar(&logFile, "log-file", "", "if specified, also write the log and the output of the build commands to this file.  The file is truncated unless --log-append is set.")
+	createBuildExecutablesCmd.Flags().BoolVar(&logAppend, "log-append", false, "if true, append to --log-file instead of truncating it")
+	createBuildExecutablesCmd.Flags().StringVar(&casDir, "cas-dir", "", "if specified, also store the binaries in this directory by sha256 digest and write a manifest.json of their digests")
+	addCachePolicyFlags(createBuildExecutablesCmd)
+	createBuildExecutablesCmd.Flags().BoolVar(&printPlan, "plan", false, "if true, print the targets, outputs, environment and commands of the build as json and exit without building")
+	createBuildExecutablesCmd.Flags().StringArrayVar(&embedDirs, "embed-dir", []string{}, "directory embedded with go:embed which must exist and not be empty.  "+
+		"src=dst replaces dst with a copy of src before building.")
+	createBuildExecutablesCmd.Flags().BoolVar(&smokeTest, "smoke-test", false, "if true, run the built apiservers with --smoke-test-args and fail if they don't exit cleanly.  Skipped when cross compiling.")
+	createBuildExecutablesCmd.Flags().BoolVar(&verifyOpenAPI, "verify-openapi", false, "if true, add a --validate-openapi mode to the apiservers and run them with it after building, "+
+		"failing if the /openapi/v2 and /openapi/v3 documents they serve don't load.  Skipped when cross compiling.")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&smokeTestArgs, "smoke-test-args", []string{"--help"}, "arguments to run the apiservers with for --smoke-test")
+	createBuildExecutablesCmd.Flags().BoolVar(&strict, "strict", false, "if true, fail instead of warning when flags are ignored, e.g. go build flags with --bazel, "+
+		"there is less than --min-disk free disk space, or go.mod requires unused modules with --prune-modules")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&k8sMatrix, "k8s-matrix", []string{}, "if specified, instead of building the targets, check the apiserver compiles against each of these k8s.io/apimachinery versions "+
+		"and the k8s.io modules released with it, and fail listing the versions it doesn't compile against.  Downloads the modules into a new module cache for each version.")
+	createBuildExecutablesCmd.Flags().BoolVar(&withPprof, "with-pprof", false, fmt.Sprintf("if true, build and generate with the %q build tag, "+
+		"which adds the unauthenticated net/http/pprof endpoints of cmd/apiserver/pprof.go to the apiserver.  "+
+		"They expose its memory and goroutine stacks, so only use it for profiling outside of production.", pprofTag))
+	createBuildExecutablesCmd.Flags().StringVar(&minDisk, "min-disk", "0", "warn, or fail with --strict, before building if the output directory, GOCACHE or the bazel output base "+
+		"have less free disk space than this quantity, e.g. 10Gi.  0 disables the check.")
+	createBuildExecutablesCmd.Flags().StringVar(&maxSize, "max-size", "", "if specified, fail after building if a binary is larger than this quantity, e.g. 80MiB")
+	createBuildExecutablesCmd.Flags().StringVar(&maxSizeApiserver, "max-size-apiserver", "", "if specified, the --max-size of the apiserver binaries")
+	createBuildExecutablesCmd.Flags().StringVar(&maxSizeController, "max-size-controller", "", "if specified, the --max-size of the controller-manager binary")
+	createBuildExecutablesCmd.Flags().BoolVar(&strip, "strip", false, "if true, omit the symbol table and DWARF debug information from the binaries with -ldflags \"-s -w\".  Ignored with --bazel.")
+	createBuildExecutablesCmd.Flags().StringVar(&buildDir, "build-dir", "", "if specified, directory to write the temporary directories, GOCACHE and the --bazel output base to, e.g. on fast scratch disk")
+	createBuildExecutablesCmd.Flags().BoolVar(&keepTemp, "keep-temp", false, "if true, don't remove the temporary directories of the build, e.g. of --verify-generated and --with-proto, and log their locations")
+	createBuildExecutablesCmd.Flags().StringVar(&emitScript, "emit-script", "", "if specified, write a script running the commands of the build with their environment to this file, "+
+		"a PowerShell script if it ends in .ps1 or --goos is windows.  Use with --plan to write it without building.")
+	createBuildExecutablesCmd.Flags().StringVar(&explain, "explain", "", "if specified, print why each target is built or skipped before building, as text or json.  "+
+		"--explain is --explain=text.  Printed to stderr with --plan.")
+	createBuildExecutablesCmd.Flags().Lookup("explain").NoOptDefVal = "text"
+	createBuildExecutablesCmd.Flags().BoolVar(&printEnv, "print-env", false, "if true, print the sorted environment of each target before building, with the values of tokens, passwords and other secrets redacted.  "+
+		"Printed to stderr with --plan.")
+	createBuildExecutablesCmd.Flags().BoolVar(&relativePaths, "relative-paths", false, "if true, log the paths of the binaries, and write them to the --plan and --manifest, "+
+		"relative to the project root.  Paths outside of the project root are left absolute.")
+	createBuildExecutablesCmd.Flags().BoolVar(&inContainer, "in-container", false, "if true, run go build with docker in the --builder-image, so the toolchain and libc don't depend on the host.  "+
+		"The project root is mounted into the container and the binaries are written to --output.")
+	createBuildExecutablesCmd.Flags().StringVar(&builderImage, "builder-image", "golang:1.17", "image with the go toolchain --in-container builds with")
+	createBuildExecutablesCmd.Flags().StringVar(&versionPackage, "version-package", "", "if specified, set the gitVersion, gitCommit and buildDate variables of the package with this import path "+
+		"to the project version, git commit and build time with -X, e.g. k8s.io/component-base/version.  The package must be importable.")
+	createBuildExecutablesCmd.Flags().BoolVar(&sbom, "sbom", false, "if true, write an SBOM of the modules compiled into each binary next to it, "+
+		"as <binary>.cdx.json or <binary>.spdx.json")
+	createBuildExecutablesCmd.Flags().StringVar(&sbomFormat, "sbom-format", "cyclonedx", "format of the --sbom, cyclonedx or spdx")
+	createBuildExecutablesCmd.Flags().StringVar(&manifestFile, "manifest", "", "if specified, write the target, platform, path, size and sha256 of every artifact, "+
+		"and the version, build time and flags of the build to this file")
+	createBuildExecutablesCmd.Flags().StringVar(&manifestFormat, "manifest-format", "json", "format of the --manifest, json or yaml")
+	createBuildExecutablesCmd.Flags().StringVar(&krewManifest, "krew-manifest", "", "if specified, archive the "+kubectlPlugin+" binary of each platform into a tar.gz next to it, "+
+		"and write a krew plugin manifest installing the archives to this file")
+	createBuildExecutablesCmd.Flags().StringVar(&krewPluginName, "krew-plugin-name", "", "name of the plugin in the --krew-manifest, installed as kubectl-<name>")
+	createBuildExecutablesCmd.Flags().StringVar(&krewURITemplate, "krew-uri-template", "", "go template for the URI each archive of the --krew-manifest is downloaded from.  "+
+		"Supports {{.Version}}, {{.OS}}, {{.Arch}} and {{.Archive}}, the file name of the archive.")
+	createBuildExecutablesCmd.Flags().StringVar(&krewShortDescription, "krew-short-description", "", "shortDescription of the plugin in the --krew-manifest")
+	createBuildExecutablesCmd.Flags().StringVar(&krewHomepage, "krew-homepage", "", "if specified, homepage of the plugin in the --krew-manifest")
+	createBuildExecutablesCmd.Flags().BoolVar(&race, "race", false, fmt.Sprintf("if true, build the %s target with the race detector.  "+
+		"The server targets are never built with -race, so they can be built together without shipping race instrumented servers.", testTarget))
+	createBuildExecutablesCmd.Flags().StringVar(&otelEndpoint, "otel-endpoint", "", "if specified, export a trace of the build with a span per phase to this OTLP gRPC collector host:port.  "+
+		"Export errors are logged and don't fail the build.")
+	createBuildExecutablesCmd.Flags().BoolVar(&otelInsecure, "otel-insecure", false, "if true, connect to the --otel-endpoint without TLS")
+	createBuildExecutablesCmd.Flags().BoolVar(&noLock, "no-lock", false, "if true, don't lock the output directory, so overlapping invocations building into it aren't serialized")
+	createBuildExecutablesCmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 10*time.Minute, "how long to wait for another invocation building into the output directory to finish, 0 waits forever")
+	createBuildExecutablesCmd.Flags().StringVar(&sourceVersion, "source-version", "", "if specified, the {{ .Version }} of the --ldflags and --name-template templates instead of git describe.  "+
+		"Use to build a source tree without git metadata, e.g. exported with git archive.")
+	createBuildExecutablesCmd.Flags().BoolVar(&pruneModules, "prune-modules", false, "if true, run go mod tidy on a copy of go.mod before building and warn, or fail with --strict, "+
+		"if go.mod requires modules the build doesn't use")
+	createBuildExecutablesCmd.Flags().BoolVar(&vulncheck, "vulncheck", false, "if true, run govulncheck on the packages of the targets before building and fail on vulnerabilities.  "+
+		"Skipped with a warning if govulncheck isn't installed.")
+	createBuildExecutablesCmd.Flags().StringVar(&vulncheckThreshold, "vulncheck-threshold", "called", "least severe vulnerability failing --vulncheck: "+
+		"called (a vulnerable function is called), imported (a vulnerable package is imported) or required (a vulnerable module is required)")
+	createBuildExecutablesCmd.Flags().StringVar(&etcdPrefix, "etcd-prefix", "", "if specified, the default etcd storage prefix of the apiservers, set with -X to the etcdPrefix string variable of --etcd-prefix-package.  "+
+		"The apiserver sets it as the default of its --etcd-prefix flag, e.g. with builder.APIServer.WithFlagFns.")
+	createBuildExecutablesCmd.Flags().StringVar(&etcdPrefixPackage, "etcd-prefix-package", "main", "import path of the package declaring the variable set by --etcd-prefix")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&featureGates, "feature-gates", []string{}, "if specified, the <name>=<bool> defaults of the feature gates of the apiservers, "+
+		"set with -X to the defaultFeatureGates string variable of --feature-gates-package.  The names must be featuregate.Feature constants of the package, "+
+		"which applies them with DefaultMutableFeatureGate.Set before the flags of the apiserver are parsed.")
+	createBuildExecutablesCmd.Flags().StringVar(&featureGatesPackage, "feature-gates-package", "", "import path of the package declaring the features and the variable set by --feature-gates, <module>/pkg/features by default")
+	createBuildExecutablesCmd.Flags().StringSliceVar(&leaderElection, "leader-election", []string{}, "if specified, the default lease-duration, renew-deadline and retry-period=<duration> "+
+		"of the controller's leader election, set with -X to the leaseDuration, renewDeadline and retryPeriod string variables of --leader-election-package")
+	createBuildExecutablesCmd.Flags().StringVar(&leaderElectionPackage, "leader-election-package", "main", "import path of the package declaring the variables set by --leader-election")
+	createBuildExecutablesCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "if specified, the default [host]:port of the controller's metrics endpoint, or 0 to disable it, "+
+		"set with -X to the metricsBindAddress string variable of --bind-address-package.  The controller's --metrics-bind-address flag still overrides it.")
+	createBuildExecutablesCmd.Flags().StringVar(&healthAddr, "health-addr", "", "if specified, the default [host]:port of the controller's health probe endpoint, or 0 to disable it, "+
+		"set with -X to the healthProbeBindAddress string variable of --bind-address-package.  The controller's --health-probe-bind-address flag still overrides it.")
+	createBuildExecutablesCmd.Flags().StringVar(&bindAddressPackage, "bind-address-package", "main", "import path of the package declaring the variables set by --metrics-addr and --health-addr")
+	createBuildExecutablesCmd.Flags().StringVar(&pluginPackage, "plugin-package", "", "package to build when --buildmode=plugin, e.g. ./plugin/admission")
 }
 
 func RunBuildExecutables(cmd *cobra.Command, args []string) {
 	if err := cmd.Flags().Parse(args); err != nil {
 		klog.Fatal(err)
 	}
+	teeLogs()
+	useBuildDir()
+	defer startTracing("build executables")()
+	if err := readTargets(os.Stdin); err != nil {
+		klog.Fatal(err)
+	}
+	for _, t := range absentTargets() {
+		klog.Infof("Skipping target %s, %s doesn't exist", t.Name, filepath.Join(t.Dir, "main.go"))
+	}
+	resolveOutputDir()
+	if withPprof {
+		enablePprof()
+	}
+	if hasSizeBudgets() {
+		checkMaxSizes()
+	}
+	if len(versionPackage) > 0 {
+		checkVersionPackage()
+	}
+	if cmd.Flags().Changed("etcd-prefix") {
+		checkEtcdPrefix()
+	}
+	if len(featureGates) > 0 {
+		checkFeatureGates()
+	}
+	if len(defaultAdmission) > 0 {
+		checkDefaultAdmission()
+	}
+	if len(leaderElection) > 0 {
+		// validate the durations and their variables before building
+		vars := leaderElectionFlags()
+		for _, t := range resolveTargets() {
+			if t.Name == controllerTarget {
+				checkLinkerVars("--leader-election", t, vars)
+			}
+		}
+		if !buildController() {
+			klog.Warningf("--leader-election has no effect without the %s target", controllerTarget)
+		}
+	}
+	if offline {
+		checkOfflineFlags(cmd)
+	}
+	if fips {
+		checkFIPSFlags()
+	}
+	if inContainer {
+		checkInContainerFlags()
+	}
+	if len(runtimeReplace) > 0 && modMode == "vendor" {
+		klog.Fatalf("--runtime-replace can't be used with --mod vendor, the vendor directory has the required %s", runtimeModule)
+	}
+	if len(metricsAddr) > 0 || len(healthAddr) > 0 {
+		// validate the addresses and their variables before building
+		bindAddressFlags()
+		for _, t := range resolveTargets() {
+			if t.Name != controllerTarget {
+				continue
+			}
+			if len(metricsAddr) > 0 {
+				checkLinkerVars("--metrics-addr", t, []string{bindAddressPackage + ".metricsBindAddress=" + metricsAddr})
+			}
+			if len(healthAddr) > 0 {
+				checkLinkerVars("--health-addr", t, []string{bindAddressPackage + ".healthProbeBindAddress=" + healthAddr})
+			}
+		}
+		if !buildController() {
+			klog.Warningf("--metrics-addr and --health-addr have no effect without the %s target", controllerTarget)
+		}
+	}
+	if sbom && sbomFormat != "cyclonedx" && sbomFormat != "spdx" {
+		klog.Fatalf("--sbom-format must be cyclonedx or spdx, got %q", sbomFormat)
+	}
+	if len(buildTrace) > 0 && !Bazel {
+		if err := os.MkdirAll(filepath.Dir(buildTrace), 0755); err != nil {
+			klog.Fatalf("could not create the directory of --build-trace %s: %v", buildTrace, err)
+		}
+	}
+	if len(krewManifest) > 0 {
+		checkKrewFlags()
+	}
+	if len(manifestFile) > 0 && manifestFormat != "json" && manifestFormat != "yaml" {
+		klog.Fatalf("--manifest-format must be json or yaml, got %q", manifestFormat)
+	}
+	if buildMode != "plugin" && !TargetsSelected() {
+		klog.Fatalf("--targets %q does not match any buildable target, valid targets are %q",
+			BuildTargets, validTargets)
+	}
+	if !Bazel {
+		checkWasm()
+		checkCompilers()
+	} else if selected(testTarget) {
+		klog.Fatalf("the %s target can't be built with --bazel, use bazel test", testTarget)
+	}
+	if !Bazel && !skipPlatformCheck {
+		checkPlatforms()
+	}
+	if !Bazel && buildMode != "plugin" {
+		checkOutputPaths()
+	}
+	if len(emitScript) > 0 {
+		writeScript()
+	}
+	if len(explain) > 0 {
+		w := os.Stdout
+		if printPlan {
+			w = os.Stderr
+		}
+		writeExplain(w)
+	}
+	if printEnv {
+		// keep the --plan json on stdout parseable
+		w := os.Stdout
+		if printPlan {
+			w = os.Stderr
+		}
+		writeEnv(w)
+	}
+	if printPlan {
+		writePlan(os.Stdout)
+		return
+	}
+	if len(k8sMatrix) > 0 {
+		runK8sMatrix()
+		return
+	}
+	if !noLock {
+		// serialize overlapping invocations building into the same directory
+		dir := outputdir
+		if Bazel {
+			dir = "bin"
+		}
+		defer lockOutput(dir)()
+	}
+	checkDiskSpace()
+	if requireClean {
+		checkCleanWorkingTree()
+	}
+	if pruneModules {
+		checkPrunedModules()
+	}
+	if vulncheck {
+		runVulncheck()
+	}
+	prepareEmbedDirs()
 	if Bazel {
+		checkBazelFlags(cmd)
 		BazelBuild(cmd, args)
 	} else {
 		GoBuild(cmd, args)
 	}
+	if smokeTest {
+		runSmokeTests()
+	}
+	if verifyOpenAPI {
+		runOpenAPIChecks()
+	}
+	if hasSizeBudgets() && (Bazel || buildMode == "plugin") {
+		// go build checks the staged binaries before installing them
+		checkBinarySizes(artifacts)
+	}
+	if sbom {
+		writeSBOMs()
+	}
+	if len(casDir) > 0 {
+		storeArtifacts(casDir)
+	}
+	if len(cacheMaxSize) > 0 || cacheMaxAge != 0 {
+		pruneCaches()
+	}
+	if len(manifestFile) > 0 {
+		writeManifest(cmd)
+	}
+	if len(krewManifest) > 0 {
+		writeKrewManifest()
+	}
+	writeGithubOutput()
+}
+
+// checkBazelFlags warns, or fails with --strict, if flags which only apply to go build are set
+func checkBazelFlags(cmd *cobra.Command) {
+	ignored := []string{}
+	for _, name := range goOnlyFlags {
+		if cmd.Flags().Changed(name) {
+			ignored = append(ignored, "--"+name)
+		}
+	}
+	if len(ignored) == 0 {
+		return
+	}
+	if strict {
+		klog.Fatalf("%s only apply to go build and can't be used with --bazel", strings.Join(ignored, ", "))
+	}
+	klog.Warningf("%s only apply to go build and are ignored with --bazel", strings.Join(ignored, ", "))
+}
+
+// gazelleArgs returns the directories to run gazelle on for --since, or nothing
+// to run gazelle on the whole repo
+func gazelleArgs() []string {
+	if len(since) == 0 {
+		return nil
+	}
+	dirs, err := changedDirs(since)
+	switch {
+	case err != nil:
+		klog.Warningf("Running gazelle on the whole repo, could not find the changes since %s: %v", since, err)
+		return nil
+	case len(dirs) == 0:
+		klog.Infof("No directories changed since %s, running gazelle on the whole repo", since)
+		return nil
+	case len(dirs) > maxGazelleDirs:
+		klog.Infof("%d directories changed since %s, running gazelle on the whole repo", len(dirs), since)
+		return nil
+	}
+	return append([]string{"--"}, dirs...)
 }
 
 func BazelBuild(cmd *cobra.Command, args []string) {
-	initApis()
+	span := startSpan("generate")
+	runGenerate()
+	span.End()
 
 	if Gazelle {
-		if _, err := os.Stat("go.mod"); err == nil { // go mod exists
+		span := startSpan("gazelle")
+		if noUpdateRepos {
+			klog.Infof("Skipping gazelle update-repos for --no-update-repos, %s is left as is", reposFile)
+		} else if _, err := os.Stat("go.mod"); err == nil { // go mod exists
 			// bazel - gomod integration
-			c := exec.Command("bazel",
-				"run",
+			c := exec.Command("bazel", bazelArgs("run",
 				"//:gazelle",
 				"--",
 				"update-repos",
 				"--from_file=go.mod",
-				"--to_macro=repos.bzl%go_repositories",
+				"--to_macro="+reposFile+"%"+reposMacro,
 				"--build_file_generation=on",
 				"--build_file_proto_mode=disable",
 				"--prune",
-			)
+			)...)
 			klog.Infof("%s", strings.Join(c.Args, " "))
-			c.Stderr = os.Stderr
-			c.Stdout = os.Stdout
+			c.Stderr = util.Stderr
+			c.Stdout = util.Stdout
 			err := c.Run()
 			if err != nil {
 				klog.Fatal(err)
 			}
 		}
 
-		c := exec.Command("bazel", "run", "//:gazelle")
+		c := exec.Command("bazel", bazelArgs("run", append([]string{"//:gazelle"}, gazelleArgs()...)...)...)
 		klog.Infof("%s", strings.Join(c.Args, " "))
 
-		c.Stderr = os.Stderr
-		c.Stdout = os.Stdout
+		c.Stderr = util.Stderr
+		c.Stdout = util.Stdout
 		err := c.Run()
 		if err != nil {
 			klog.Fatal(err)
 		}
+		span.End()
 	}
 
+	targets := resolveTargets()
 	targetDirs := make([]string, 0)
-	if buildApiserver() {
-		targetDirs = append(targetDirs, filepath.Join("cmd", "apiserver"))
+	for _, t := range targets {
+		targetDirs = append(targetDirs, t.Dir)
 	}
-	if buildController() {
-		targetDirs = append(targetDirs, filepath.Join("cmd", "manager"))
-	}
-	c := exec.Command("bazel", append([]string{"build"}, targetDirs...)...)
+	span = startSpan("build", attribute.Array("targets", targetDirs))
+	c := exec.Command("bazel", bazelArgs("build", targetDirs...)...)
 	klog.Infof("%s", strings.Join(c.Args, " "))
-	c.Stderr = os.Stderr
-	c.Stdout = os.Stdout
+	c.Stderr = util.Stderr
+	c.Stdout = util.Stdout
 	err := c.Run()
+	endSpan(span, err)
 	if err != nil {
 		klog.Fatal(err)
 	}
 
-	os.RemoveAll(filepath.Join("bin", "apiserver"))
-	os.RemoveAll(filepath.Join("bin", "controller-manager"))
+	if bazelNoCopy {
+		for _, t := range targets {
+			src, err := findBazelOutput(t)
+			if err != nil {
+				klog.Fatal(err)
+			}
+			path, err := filepath.EvalSymlinks(src)
+			if err != nil {
+				klog.Fatalf("could not resolve the output of %s: %v", t.Name, err)
+			}
+			fmt.Fprintln(util.Stdout, displayPath(path))
+			artifacts = append(artifacts, artifact{Target: t.Name, Path: path, OS: runtime.GOOS, Arch: runtime.GOARCH})
+		}
+		return
+	}
 
-	if buildApiserver() {
-		c := exec.Command("cp",
-			filepath.Join("bazel-bin", "cmd", "apiserver", "apiserver_", "apiserver"),
-			filepath.Join("bin", "apiserver"))
-		klog.Infof("%s", strings.Join(c.Args, " "))
-		c.Stderr = os.Stderr
-		c.Stdout = os.Stdout
-		err := c.Run()
-		if err != nil {
+	span = startSpan("copy")
+	defer span.End()
+
+	for _, t := range targets {
+		if err := checkSymlinkOutput(filepath.Join("bin", filepath.Base(t.Dir))); err != nil {
 			klog.Fatal(err)
 		}
 	}
 
-	if buildController() {
-		c := exec.Command("cp",
-			filepath.Join("bazel-bin", "cmd", "manager", "manager_", "manager"),
-			filepath.Join("bin", "manager"))
-		klog.Infof("%s", strings.Join(c.Args, " "))
-		c.Stderr = os.Stderr
-		c.Stdout = os.Stdout
-		err := c.Run()
+	removeAll(filepath.Join("bin", "apiserver"))
+	removeAll(filepath.Join("bin", "controller-manager"))
+	forgetBuildKeys("bin")
+
+	for _, t := range targets {
+		name := filepath.Base(t.Dir)
+		src, err := findBazelOutput(t)
 		if err != nil {
 			klog.Fatal(err)
 		}
+		dst := filepath.Join("bin", name)
+		klog.Infof("Copying %s to %s", displayPath(src), dst)
+		if err := copyFile(src, dst); err != nil {
+			klog.Fatal(err)
+		}
+		// bazel builds for the host platform
+		artifacts = append(artifacts, artifact{Target: t.Name, Path: dst, OS: runtime.GOOS, Arch: runtime.GOARCH})
 	}
 }
 
+// bazelArgs returns the args of the bazel command with the --bazel-flag flags.  The same flags are
+// passed to each command, as bazel discards its analysis cache when the options change between commands.
+func bazelArgs(command string, args ...string) []string {
+	flags := []string{}
+	if len(buildDir) > 0 {
+		flags = append(flags, "--output_base="+filepath.Join(buildDir, "bazel"))
+	}
+	flags = append(append(flags, command), bazelFlags...)
+	return append(flags, args...)
+}
+
+// bazelOutput returns the path under bazel-bin of the binary bazel builds for target t
+func bazelOutput(t buildTarget) string {
+	name := filepath.Base(t.Dir)
+	return filepath.Join("bazel-bin", t.Dir, name+"_", name)
+}
+
+// findBazelOutput returns the binary bazel built for target t, asking bazel cquery for the
+// files of the target if it isn't at the rules_go path from bazelOutput
+func findBazelOutput(t buildTarget) (string, error) {
+	src := bazelOutput(t)
+	if _, err := os.Stat(src); err == nil {
+		return src, nil
+	}
+	c := exec.Command("bazel", bazelArgs("cquery", "--output=files", "//"+filepath.ToSlash(t.Dir))...)
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	c.Stderr = util.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("could not find the binary of %s at %s, and bazel cquery failed: %v", t.Name, src, err)
+	}
+	files := strings.Fields(string(out))
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil && !info.IsDir() {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("could not find the binary of %s at %s or in the files of //%s from bazel cquery %q",
+		t.Name, src, filepath.ToSlash(t.Dir), files)
+}
+
 func GoBuild(cmd *cobra.Command, args []string) {
-	initApis()
+	span := startSpan("generate")
+	runGenerate()
+	span.End()
+
+	if buildMode == "plugin" {
+		buildPlugin()
+		return
+	}
 
-	os.RemoveAll(filepath.Join("bin", "apiserver"))
-	os.RemoveAll(filepath.Join("bin", "controller-manager"))
+	if len(runtimeReplace) > 0 {
+		defer setupRuntimeReplace()()
+	}
+	if offline {
+		checkOfflineModules()
+	}
 
-	if buildApiserver() {
-		// Build the apiserver
-		path := filepath.Join("cmd", "apiserver", "main.go")
-		c := exec.Command("go", "build", "-o", filepath.Join(outputdir, "apiserver"), path)
-		c.Env = append(os.Environ(), "CGO_ENABLED=0")
-		klog.Infof("CGO_ENABLED=0")
-		if len(goos) > 0 {
-			c.Env = append(c.Env, fmt.Sprintf("GOOS=%s", goos))
-			klog.Infof(fmt.Sprintf("GOOS=%s", goos))
+	// build into a directory private to this invocation, and move the binaries into
+	// the output directory once all of them are built
+	if err := os.MkdirAll(outputdir, 0755); err != nil {
+		klog.Fatalf("could not create --output directory %s: %v", outputdir, err)
+	}
+	var err error
+	stageDir, err = tempDir(outputdir, ".apiserver-boot-build-")
+	if err != nil {
+		klog.Fatalf("could not create a temporary directory in %s: %v", outputdir, err)
+	}
+
+	ctx := context.Background()
+	if buildTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, buildTimeout)
+		defer cancel()
+	}
+
+	env := userEnv()
+	failed := []string{}
+	keys := map[string]builtBinary{}
+	if incremental {
+		keys = readBuildKeys()
+	}
+	built := map[string]builtBinary{}
+build:
+	for _, p := range buildPlatforms() {
+		goos, goarch = p.OS, p.Arch
+		for _, t := range resolveTargets() {
+			key := ""
+			if incremental && !t.Test {
+				var err error
+				if key, err = buildKey(t, env); err != nil {
+					klog.Warningf("--incremental: building %s%s: %v", t.Name, platformSuffix(), err)
+				} else if reuseBinary(t, keys, key) {
+					continue
+				}
+			}
+			span := startSpan("build "+t.Name, attribute.String("target", t.Name),
+				attribute.String("os", targetOS()), attribute.String("arch", targetArch()))
+			err := goBuildTarget(ctx, t, env)
+			endSpan(span, err)
+			if err == nil && len(key) > 0 {
+				digest, err := fileDigest(targetOutput(t))
+				if err != nil {
+					klog.Fatal(err)
+				}
+				built[stagedKey(t)] = builtBinary{Key: key, Digest: digest}
+			}
+			if err != nil {
+				klog.Errorf("%v", err)
+				failed = append(failed, t.Name+platformSuffix())
+				if !keepGoing {
+					break build
+				}
+			}
 		}
-		if len(goarch) > 0 {
-			c.Env = append(c.Env, fmt.Sprintf("GOARCH=%s", goarch))
-			klog.Infof(fmt.Sprintf("GOARCH=%s", goarch))
+	}
+
+	if hasSizeBudgets() {
+		checkBinarySizes(staged)
+	}
+	installStaged()
+	if incremental {
+		for rel, b := range built {
+			keys[rel] = b
 		}
+		writeBuildKeys(keys)
+	} else {
+		forgetBuildKeys(outputdir)
+	}
+	if len(failed) > 0 {
+		klog.Fatalf("failed to build targets %s", strings.Join(failed, ", "))
+	}
+}
 
-		klog.Infof("%s", strings.Join(c.Args, " "))
-		c.Stderr = os.Stderr
-		c.Stdout = os.Stdout
-		err := c.Run()
-		if err != nil {
+// installStaged moves the binaries built into stageDir into the output directory
+func installStaged() {
+	defer removeTempDir(stageDir)
+	defer startSpan("copy").End()
+
+	// check all the binaries before installing any, so bin isn't left with some of them replaced
+	for _, a := range staged {
+		if err := checkSymlinkOutput(installPath(a)); err != nil {
 			klog.Fatal(err)
 		}
 	}
 
-	if buildController() {
-		// Build the controller manager
-		gocache := os.Getenv("GOCACHE")
-		localAppData := os.Getenv("%LocalAppData%")
-		path := filepath.Join("cmd", "manager", "main.go")
-		c := exec.Command("go", "build", "-o", filepath.Join(outputdir, "controller-manager"), path)
-		// add GOCACHE and LocalAppData environment variable
-		if len(localAppData) > 0 {
-			c.Env = append(c.Env, fmt.Sprintf("GOCACHE=%s", gocache))
+	removeAll(filepath.Join("bin", "apiserver"))
+	removeAll(filepath.Join("bin", "controller-manager"))
+	for _, a := range staged {
+		dst := installPath(a)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			klog.Fatalf("could not create %s: %v", filepath.Dir(dst), err)
 		}
-		if len(localAppData) > 0 {
-			c.Env = append(c.Env, fmt.Sprintf("LocalAppData=%s", localAppData))
+		if err := os.Rename(a.Path, dst); err != nil {
+			klog.Fatalf("could not move %s to %s: %v", a.Path, dst, err)
 		}
-		if len(os.Getenv("CGO_ENABLED")) == 0 {
-			c.Env = append(os.Environ(), "CGO_ENABLED=0")
+		a.Path = dst
+		artifacts = append(artifacts, a)
+	}
+}
+
+// installPath returns the path in the output directory of the staged artifact a
+func installPath(a artifact) string {
+	rel, err := filepath.Rel(stageDir, a.Path)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	return filepath.Join(outputdir, rel)
+}
+
+// goBuildTarget runs go build for target t, applying --timeout-per-target
+func goBuildTarget(ctx context.Context, t buildTarget, env []string) error {
+	targetCtx := ctx
+	if targetTimeout > 0 {
+		var cancel context.CancelFunc
+		targetCtx, cancel = context.WithTimeout(ctx, targetTimeout)
+		defer cancel()
+	}
+
+	c := goBuildCommand(targetCtx, t, targetOutput(t), env)
+	for _, e := range targetEnv(t, env) {
+		klog.Infof("%s", redactEnv(e))
+	}
+	warnDarwinCgo(t, env)
+	warnCgoFlags(t, env)
+	klog.Infof("%s", strings.Join(displayArgs(c.Args), " "))
+	c.Stderr = util.Stderr
+	c.Stdout = util.Stdout
+	err := c.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("target %s%s timed out: building all targets took longer than --timeout %v", t.Name, platformSuffix(), buildTimeout)
+	case targetCtx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("target %s%s timed out after --timeout-per-target %v", t.Name, platformSuffix(), targetTimeout)
+	case err != nil:
+		return fmt.Errorf("target %s%s failed: %v", t.Name, platformSuffix(), err)
+	}
+	outputs := []string{targetOutput(t)}
+	if t.Test {
+		if outputs, err = testBinaries(targetOutput(t)); err != nil {
+			return fmt.Errorf("target %s%s: %v", t.Name, platformSuffix(), err)
 		}
-		if len(goos) > 0 {
-			c.Env = append(c.Env, fmt.Sprintf("GOOS=%s", goos))
+	}
+	for _, output := range outputs {
+		if verifyPlatform && crossCompiling() && executableBuildMode() {
+			if err := checkBinaryPlatform(output, targetOS(), targetArch()); err != nil {
+				return fmt.Errorf("target %s%s: %v", t.Name, platformSuffix(), err)
+			}
 		}
-		if len(goarch) > 0 {
-			c.Env = append(c.Env, fmt.Sprintf("GOARCH=%s", goarch))
+		if fips && executableBuildMode() {
+			if err := checkFIPSBinary(output); err != nil {
+				return fmt.Errorf("target %s%s: %v", t.Name, platformSuffix(), err)
+			}
 		}
+		staged = append(staged, artifact{Target: t.Name, Path: output, OS: targetOS(), Arch: targetArch()})
+	}
+	return nil
+}
 
-		klog.Infof(strings.Join(c.Args, " "))
-		c.Stderr = os.Stderr
-		c.Stdout = os.Stdout
-		err := c.Run()
-		if err != nil {
-			klog.Fatal(err)
+// testBinaries returns the test binaries go test -c wrote to dir
+func testBinaries(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		klog.Warningf("no test binaries were built, the packages have no tests")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, f := range files {
+		paths = append(paths, filepath.Join(dir, f.Name()))
+	}
+	return paths, nil
+}
+
+// targetOutput returns the path go build writes the binary of target t to
+func targetOutput(t buildTarget) string {
+	return filepath.Join(stageDir, targetDir(t), outputName(t))
+}
+
+// outputName returns the file name of the binary of target t, or the directory name of a Test target
+func outputName(t buildTarget) string {
+	if t.Test {
+		return t.Binary
+	}
+	return binaryName(t.Binary)
+}
+
+// goBuildCommand returns the go build command writing target t to output with the extra environment env
+func goBuildCommand(ctx context.Context, t buildTarget, output string, env []string) *exec.Cmd {
+	// the package rather than its main.go, so the other files of the target, e.g. the generated ones, are built
+	path := "./" + filepath.ToSlash(t.Dir)
+	if t.Test {
+		// go test -c writes a binary per package into the directory output ends with a separator
+		path = "./" + filepath.ToSlash(t.Dir) + "/..."
+		output += string(filepath.Separator)
+	}
+	if inContainer {
+		return containerCommand(ctx, append(goBuildArgs(t), "-o", output, filepath.ToSlash(path)), targetEnv(t, env), output)
+	}
+	c := exec.CommandContext(ctx, goBinary(), append(goBuildArgs(t), "-o", output, path)...)
+	c.Env = append(os.Environ(), targetEnv(t, env)...)
+	return c
+}
+
+// targetEnv returns the variables go build sets for target t on top of the inherited environment
+func targetEnv(t buildTarget, env []string) []string {
+	overrides := []string{}
+	cgo := os.Getenv("CGO_ENABLED")
+	switch {
+	case race && t.Test:
+		// the race detector requires cgo
+		overrides = append(overrides, "CGO_ENABLED=1")
+		cgo = "1"
+	case fips:
+		// BoringCrypto is linked with cgo, CGO_ENABLED=1 is set after env below
+		cgo = "1"
+	case buildMode == "plugin":
+		// plugins are always built with cgo
+		overrides = append(overrides, "CGO_ENABLED=1")
+		cgo = "1"
+	case !(t.KeepCgoEnv || respectCgoEnv) || len(cgo) == 0:
+		overrides = append(overrides, "CGO_ENABLED=0")
+		cgo = "0"
+	}
+	if len(goos) > 0 {
+		overrides = append(overrides, fmt.Sprintf("GOOS=%s", goos))
+	}
+	if len(goarch) > 0 {
+		overrides = append(overrides, fmt.Sprintf("GOARCH=%s", goarch))
+	}
+	if cgo != "0" {
+		overrides = append(overrides, ccEnv()...)
+	}
+	if len(runtimeModFile) > 0 {
+		// -modfile can't be used in workspace mode
+		overrides = append(overrides, "GOWORK=off")
+	}
+	result := append(overrides, env...)
+	if fips {
+		// after env, so a GOEXPERIMENT or CGO_ENABLED of env doesn't drop BoringCrypto
+		result = append(append(result, "CGO_ENABLED=1"), fipsEnv(env)...)
+	}
+	if trimpath {
+		// after env, which can set GOFLAGS too, so go commands run by the build also leave the
+		// source and module cache paths out of what they build
+		result = append(result, "GOFLAGS="+mergeGoflags(lastEnv(result, "GOFLAGS", os.Getenv("GOFLAGS")), "-trimpath"))
+	}
+	if lastEnv(result, "CGO_ENABLED", cgo) != "0" {
+		result = append(result, cgoFlagsEnv(env)...)
+	}
+	return result
+}
+
+// lastEnv returns the value of the last key entry of env, or value if there isn't one
+func lastEnv(env []string, key, value string) string {
+	for _, e := range env {
+		if strings.HasPrefix(e, key+"=") {
+			value = strings.TrimPrefix(e, key+"=")
 		}
 	}
+	return value
+}
+
+// cgoEnabled returns true if target t is built with cgo
+func cgoEnabled(t buildTarget, env []string) bool {
+	return lastEnv(targetEnv(t, env), "CGO_ENABLED", os.Getenv("CGO_ENABLED")) != "0"
+}
+
+// warnDarwinCgo warns if target t is built for darwin without cgo, where go uses its own DNS
+// resolver instead of the system one
+func warnDarwinCgo(t buildTarget, env []string) {
+	if targetOS() != "darwin" {
+		return
+	}
+	if cgoEnabled(t, env) {
+		return
+	}
+	klog.Warningf("Building %s for darwin with CGO_ENABLED=0, so it resolves names with the pure Go resolver "+
+		"which ignores the system DNS configuration, e.g. VPN and /etc/resolver domains.  "+
+		"Build with CGO_ENABLED=1 and --respect-cgo-env to use the system resolver.", t.Name)
 }
 
-func buildApiserver() bool {
-	for _, t := range BuildTargets {
-		if t == apiserverTarget {
-			return true
+// templateArgs are the variables available to the --name-template and --ldflags templates
+type templateArgs struct {
+	Target  string
+	Version string
+	OS      string
+	Arch    string
+}
+
+// renderTemplate renders the value of the flag called name as a go template for the binary
+// named target on the current platform
+func renderTemplate(name, value, target string) string {
+	t, err := template.New(name).Option("missingkey=error").Parse(value)
+	if err != nil {
+		klog.Fatalf("invalid --%s %q: %v", name, value, err)
+	}
+	b := &bytes.Buffer{}
+	err = t.Execute(b, templateArgs{
+		Target:  target,
+		Version: projectVersion(),
+		OS:      targetOS(),
+		Arch:    targetArch(),
+	})
+	if err != nil {
+		klog.Fatalf("invalid --%s %q: %v", name, value, err)
+	}
+	return b.String()
+}
+
+// binaryName returns the file name for the binary named target using --name-template
+func binaryName(target string) string {
+	name := target
+	if len(nameTemplate) > 0 {
+		name = renderTemplate("name-template", nameTemplate, target)
+		if len(name) == 0 || strings.ContainsAny(name, `/\`) {
+			klog.Fatalf("--name-template %q must render to a file name, got %q", nameTemplate, name)
+		}
+	}
+	if targetArch() == "wasm" && !strings.HasSuffix(name, ".wasm") {
+		name += ".wasm"
+	}
+	return name
+}
+
+// goBinary returns the go binary to run for building
+func goBinary() string {
+	if len(goBin) > 0 {
+		return goBin
+	}
+	if e := os.Getenv("GO"); len(e) > 0 {
+		return e
+	}
+	return "go"
+}
+
+// goBuildArgs returns the leading go build arguments for target t
+func goBuildArgs(t buildTarget) []string {
+	args := []string{"build"}
+	if t.Test {
+		args = []string{"test", "-c"}
+		if race {
+			args = append(args, "-race")
 		}
+	} else if len(buildMode) > 0 {
+		args = append(args, "-buildmode="+buildMode)
+	}
+	if len(modMode) > 0 {
+		args = append(args, "-mod="+modMode)
+	}
+	args = append(args, runtimeReplaceArgs()...)
+	if trimpath {
+		args = append(args, "-trimpath")
+	}
+	if len(sourceVersion) > 0 && goAtLeast(18) {
+		// the version comes from the flag, so don't stamp the binaries with a git checkout the tree may be under.
+		// go1.17 has no -buildvcs and doesn't stamp the binaries.
+		args = append(args, "-buildvcs=false")
+	}
+	if compileParallelism > 0 {
+		args = append(args, fmt.Sprintf("-p=%d", compileParallelism))
+	}
+	if len(buildTrace) > 0 {
+		args = append(args, "-debug-trace="+buildTraceFile(t))
+	}
+	if flags := linkerFlags(t); len(flags) > 0 {
+		args = append(args, "-ldflags="+flags)
+	}
+	if len(gcflags) > 0 {
+		args = append(args, "-gcflags="+gcflags)
+	}
+	if len(asmflags) > 0 {
+		args = append(args, "-asmflags="+asmflags)
 	}
-	return false
+	return args
 }
 
-func buildController() bool {
-	for _, t := range BuildTargets {
-		if t == controllerTarget {
-			return true
+// buildPlugin builds the package pluginPackage as a Go plugin into the output directory, for each
+// of the --platforms
+func buildPlugin() {
+	if len(pluginPackage) == 0 {
+		klog.Fatalf("Must specify --plugin-package with --buildmode=plugin")
+	}
+	klog.Warningf("Go plugins only load into a binary built with the same Go toolchain, " +
+		"build flags and dependency versions as the plugin.")
+
+	for _, p := range buildPlatforms() {
+		goos, goarch = p.OS, p.Arch
+		output := pluginOutput()
+		removeAll(output)
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			klog.Fatalf("could not create %s: %v", filepath.Dir(output), err)
 		}
+
+		c := pluginCommand(output)
+		for _, e := range pluginEnv() {
+			klog.Infof("%s", redactEnv(e))
+		}
+		klog.Infof("%s", strings.Join(displayArgs(c.Args), " "))
+		c.Stderr = util.Stderr
+		c.Stdout = util.Stdout
+		err := c.Run()
+		if err != nil {
+			klog.Fatalf("--plugin-package %s%s: %v", pluginPackage, platformSuffix(), err)
+		}
+		artifacts = append(artifacts, artifact{Target: "plugin", Path: output, OS: targetOS(), Arch: targetArch()})
+	}
+}
+
+// pluginTarget is the --plugin-package as a target, so the plugin is built with the flags and
+// environment of the other targets
+func pluginTarget() buildTarget {
+	return buildTarget{Name: "plugin", Dir: pluginPackage, Binary: path.Base(filepath.ToSlash(pluginPackage))}
+}
+
+// pluginOutput returns the path of the .so built from pluginPackage for the current platform
+func pluginOutput() string {
+	return filepath.Join(outputdir, platformDir(), pluginTarget().Binary+".so")
+}
+
+// pluginCommand returns the go build command writing pluginPackage to output
+func pluginCommand(output string) *exec.Cmd {
+	c := exec.Command(goBinary(), append(goBuildArgs(pluginTarget()), "-o", output, pluginPackage)...)
+	c.Env = append(os.Environ(), pluginEnv()...)
+	return c
+}
+
+// pluginEnv returns the variables go build sets for the plugin on top of the inherited environment
+func pluginEnv() []string {
+	return targetEnv(pluginTarget(), userEnv())
+}
+
+// executableBuildMode returns true if --buildmode produces an executable or shared object
+func executableBuildMode() bool {
+	switch buildMode {
+	case "archive", "c-archive":
+		return false
 	}
-	return false
+	return true
 }
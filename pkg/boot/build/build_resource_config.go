@@ -24,9 +24,11 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -45,6 +47,7 @@ var ControllerSecretEnv []string
 var ImagePullSecrets []string
 var ServiceAccount string
 var StorageClass string
+var validateResourceConfig bool
 
 var buildResourceConfigCmd = &cobra.Command{
 	Use:   "config",
@@ -60,6 +63,9 @@ apiserver-boot build config --name nameofservice --namespace mysystemnamespace -
 # controller-manager locally, but registered through aggregation into a local minikube cluster
 # Generates CA and apiserver certificates.
 apiserver-boot build config --name nameofservice --namespace mysystemnamespace --local-minikube
+
+# Also check the cluster of the current kubeconfig context accepts the resource config
+apiserver-boot build config --name nameofservice --namespace mysystemnamespace --image gcr.io/myrepo/myimage:mytag --validate
 `,
 	Run: RunBuildResourceConfig,
 }
@@ -82,6 +88,8 @@ func AddBuildResourceConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&Image, "image", "", "name of the apiserver Image with tag")
 	cmd.Flags().StringVar(&ResourceConfigDir, "output", "config", "directory to output resourceconfig")
 	cmd.Flags().StringVar(&StorageClass, "storage-class", "standard", "storageclass of which etcd is using to store data")
+	cmd.Flags().BoolVar(&validateResourceConfig, "validate", false, "if true, check the resource config with kubectl apply --dry-run=server against the current kubeconfig context "+
+		"and fail listing the objects it rejects")
 }
 
 func RunBuildResourceConfig(cmd *cobra.Command, args []string) {
@@ -102,6 +110,35 @@ func RunBuildResourceConfig(cmd *cobra.Command, args []string) {
 
 	createCerts()
 	buildResourceConfig()
+	if validateResourceConfig {
+		validateConfig()
+	}
+}
+
+// validateConfig runs kubectl apply --dry-run=server on the resource config and exits listing
+// the errors for the objects the cluster rejects, e.g. for RBAC or APIService misconfigurations
+func validateConfig() {
+	c := exec.Command("kubectl", "apply", "--dry-run=server", "-f", ResourceConfigDir)
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	stderr := &bytes.Buffer{}
+	c.Stdout = util.Stdout
+	c.Stderr = stderr
+	err := c.Run()
+	// kubectl reports each rejected object, and warnings, on a line of stderr
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		switch {
+		case len(line) == 0:
+		case err == nil:
+			klog.Warningf("%s", line)
+		default:
+			klog.Errorf("%s", line)
+		}
+	}
+	if err == nil {
+		klog.Infof("The resource config in %s is valid", ResourceConfigDir)
+		return
+	}
+	klog.Fatalf("--validate: the cluster rejected the resource config in %s: %v", ResourceConfigDir, err)
 }
 
 func getBase64(file string) string {
@@ -0,0 +1,144 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+var targetsJSON bool
+var targetsChanged bool
+var targetsSince string
+
+var buildTargetsCmd = &cobra.Command{
+	Use:   "targets",
+	Short: "List the targets build executables --targets accepts in this project",
+	Long:  `List the targets build executables --targets accepts in this project, with their source directories and whether they are present`,
+	Example: `# List the targets
+apiserver-boot build targets
+
+# List the targets as json
+apiserver-boot build targets --json
+
+# Build the targets with changes since origin/master
+apiserver-boot build targets --changed --since origin/master | apiserver-boot build executables --targets -`,
+	Run: RunBuildTargets,
+}
+
+func AddBuildTargets(cmd *cobra.Command) {
+	cmd.AddCommand(buildTargetsCmd)
+	buildTargetsCmd.Flags().BoolVar(&targetsJSON, "json", false, "if true, print the targets as json")
+	buildTargetsCmd.Flags().BoolVar(&targetsChanged, "changed", false, "if true, print only the names of the present targets with changes since --since, one per line.  "+
+		"Changes outside of cmd/ change every target.")
+	buildTargetsCmd.Flags().StringVar(&targetsSince, "since", "HEAD", "git ref --changed finds the changes since")
+}
+
+// targetInfo describes a target in the output of build targets
+type targetInfo struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Binary  string `json:"binary"`
+	Present bool   `json:"present"`
+}
+
+func RunBuildTargets(cmd *cobra.Command, args []string) {
+	targets, err := projectTargets()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if targetsChanged {
+		dirs, err := changedDirs(targetsSince)
+		if err != nil {
+			klog.Fatalf("could not find the changes since %s: %v", targetsSince, err)
+		}
+		for _, t := range targets {
+			if t.Present && targetChanged(t, dirs) {
+				fmt.Println(t.Name)
+			}
+		}
+		return
+	}
+	if targetsJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(targets); err != nil {
+			klog.Fatal(err)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tBINARY\tPRESENT")
+	for _, t := range targets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\n", t.Name, t.Source, t.Binary, t.Present)
+	}
+	w.Flush()
+}
+
+// projectTargets returns the builtin targets followed by an apiserver:<group> target
+// for each cmd/apiserver-<group> directory with a main.go
+func projectTargets() ([]targetInfo, error) {
+	targets := []targetInfo{}
+	for _, t := range builtinTargets {
+		targets = append(targets, describeTarget(t))
+	}
+	dirs, err := ioutil.ReadDir("cmd")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read cmd directory: %v", err)
+	}
+	for _, d := range dirs {
+		group := strings.TrimPrefix(d.Name(), "apiserver-")
+		if !d.IsDir() || group == d.Name() || len(group) == 0 {
+			continue
+		}
+		t, _ := lookupTarget(apiserverTarget + ":" + group)
+		targets = append(targets, describeTarget(t))
+	}
+	return targets, nil
+}
+
+func describeTarget(t buildTarget) targetInfo {
+	return targetInfo{
+		Name:    t.Name,
+		Source:  filepath.ToSlash(t.Dir),
+		Binary:  t.Binary,
+		Present: targetPresent(t),
+	}
+}
+
+// targetChanged returns true if one of the changed dirs is in the source of t, or outside
+// of cmd/ where it may be shared by every target
+func targetChanged(t targetInfo, dirs []string) bool {
+	source := filepath.FromSlash(t.Source)
+	for _, d := range dirs {
+		if d == source || strings.HasPrefix(d, source+string(filepath.Separator)) {
+			return true
+		}
+		if d != "cmd" && !strings.HasPrefix(d, "cmd"+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+var buildTrace string
+
+// buildTraceFile returns the file go build writes the -debug-trace of target t to.  With more than
+// one go build, the target and platform are added to the --build-trace name, e.g. trace-apiserver-linux-amd64.json.
+func buildTraceFile(t buildTarget) string {
+	if len(resolveTargets())*len(buildPlatforms()) == 1 {
+		return buildTrace
+	}
+	ext := filepath.Ext(buildTrace)
+	return strings.TrimSuffix(buildTrace, ext) + "-" + t.Binary + "-" + targetOS() + "-" + targetArch() + ext
+}
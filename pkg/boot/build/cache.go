@@ -0,0 +1,175 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+var cacheMaxSize string
+var cacheMaxAge time.Duration
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Command group for managing the build caches.",
+	Long:  `Command group for managing the go build cache and the --cas-dir of build executables.`,
+	Example: `# Remove the entries of the go build cache and of the content addressed store not used in the last week
+apiserver-boot build cache prune --cas-dir /var/cache/apiserver-builds --cache-max-age 168h`,
+	Run: RunCache,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the least recently used entries of the build caches",
+	Long: `Remove the entries of the go build cache, and of the --cas-dir if it is set, not used within --cache-max-age, ` +
+		`then the least recently used entries until each cache is at most --cache-max-size`,
+	Example: `# Keep the go build cache under --build-dir at most 2GiB
+apiserver-boot build cache prune --build-dir /mnt/scratch/apiserver-boot --cache-max-size 2GiB
+
+# Remove the binaries stored in the content addressed store more than 30 days ago
+apiserver-boot build cache prune --cas-dir /var/cache/apiserver-builds --cache-max-age 720h`,
+	Run: RunCachePrune,
+}
+
+func AddCache(cmd *cobra.Command) {
+	cmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+
+	cachePruneCmd.Flags().StringVar(&casDir, "cas-dir", "", "if specified, also prune the binaries stored in this directory by build executables --cas-dir, "+
+		"except those of its manifest.json")
+	cachePruneCmd.Flags().StringVar(&buildDir, "build-dir", "", "if specified, prune the go build cache under this build executables --build-dir instead of GOCACHE")
+	addCachePolicyFlags(cachePruneCmd)
+}
+
+// addCachePolicyFlags adds the flags limiting the size and age of the build caches to cmd
+func addCachePolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cacheMaxSize, "cache-max-size", "", "if specified, remove the least recently used entries of the go build cache and of the --cas-dir "+
+		"until each is at most this size, e.g. 10GiB")
+	cmd.Flags().DurationVar(&cacheMaxAge, "cache-max-age", 0, "if specified, remove the entries of the go build cache and of the --cas-dir not used for this long, e.g. 168h")
+}
+
+func RunCache(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func RunCachePrune(cmd *cobra.Command, args []string) {
+	if len(cacheMaxSize) == 0 && cacheMaxAge == 0 {
+		klog.Fatalf("nothing to prune, specify --cache-max-size or --cache-max-age")
+	}
+	useBuildDir()
+	pruneCaches()
+}
+
+// pruneCaches applies the --cache-max-size and --cache-max-age policy to the go build cache and the --cas-dir
+func pruneCaches() {
+	if cacheMaxAge < 0 {
+		klog.Fatalf("invalid --cache-max-age %v, must not be negative", cacheMaxAge)
+	}
+	var maxBytes int64 = -1
+	if len(cacheMaxSize) > 0 {
+		maxBytes = parseSize("cache-max-size", cacheMaxSize)
+	}
+
+	out, err := exec.Command(goBinary(), "env", "GOCACHE").Output()
+	if dir := strings.TrimSpace(string(out)); err == nil && len(dir) > 0 && dir != "off" {
+		// the README and trim.txt of the go build cache aren't cache entries
+		pruneCache("go build cache", dir, maxBytes, map[string]bool{"README": true, "trim.txt": true})
+	} else if err != nil {
+		klog.Warningf("could not find the go build cache to prune with go env GOCACHE: %v", err)
+	}
+	if len(casDir) > 0 {
+		// the artifacts of the last build are kept whatever their age
+		keep := map[string]bool{"manifest.json": true}
+		for _, d := range manifestDigests(casDir) {
+			keep[d] = true
+		}
+		pruneCache("--cas-dir", casDir, maxBytes, keep)
+	}
+}
+
+type cacheEntry struct {
+	path string
+	size int64
+	used time.Time
+}
+
+// pruneCache removes the files under dir not used within --cache-max-age, then the least recently
+// used files until they total at most maxBytes if it isn't negative.  The files whose path relative
+// to dir is in keep are never removed.
+func pruneCache(name, dir string, maxBytes int64, keep map[string]bool) {
+	entries := []cacheEntry{}
+	var total int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil && keep[filepath.ToSlash(rel)] {
+			return nil
+		}
+		entries = append(entries, cacheEntry{path: path, size: info.Size(), used: lastUsed(path, info)})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		klog.Fatalf("could not read the %s %s: %v", name, dir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+
+	var reclaimed int64
+	removed := 0
+	cutoff := time.Now().Add(-cacheMaxAge)
+	for _, e := range entries {
+		expired := cacheMaxAge > 0 && e.used.Before(cutoff)
+		if !expired && (maxBytes < 0 || total <= maxBytes) {
+			break
+		}
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			klog.Warningf("could not remove %s from the %s: %v", e.path, name, err)
+			continue
+		}
+		total -= e.size
+		reclaimed += e.size
+		removed++
+	}
+	klog.Infof("Pruned %d of %d files from the %s %s, reclaimed %.1fMiB, %.1fMiB remain",
+		removed, len(entries), name, displayPath(dir), float64(reclaimed)/(1<<20), float64(total)/(1<<20))
+}
+
+// lastUsed returns the later of the access and modification times of the file at path.  The
+// modification time is also used as the access time isn't updated on filesystems mounted with
+// noatime, and go refreshes the modification times of the build cache entries it uses.
+func lastUsed(path string, info os.FileInfo) time.Time {
+	used := info.ModTime()
+	if atime, err := accessTime(path, info); err == nil && atime.After(used) {
+		used = atime
+	}
+	return used
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// storeArtifacts copies the built artifacts into dir named by their sha256 digest, and
+// writes dir/manifest.json mapping the artifact file names to their digests
+func storeArtifacts(dir string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		klog.Fatalf("could not create --cas-dir %s: %v", dir, err)
+	}
+	manifest := map[string]string{}
+	for _, a := range artifacts {
+		digest, err := fileDigest(a.Path)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		dst := filepath.Join(dir, digest)
+		if _, err := os.Stat(dst); err == nil {
+			klog.Infof("%s is already stored as %s", displayPath(a.Path), displayPath(dst))
+			// mark the blob used, so --cache-max-age prunes by its last store rather than its first
+			now := time.Now()
+			if err := os.Chtimes(dst, now, now); err != nil {
+				klog.Warningf("could not update the modification time of %s: %v", displayPath(dst), err)
+			}
+		} else if err := copyFile(a.Path, dst); err != nil {
+			klog.Fatal(err)
+		} else {
+			klog.Infof("Stored %s as %s", displayPath(a.Path), displayPath(dst))
+		}
+		manifest[filepath.Base(a.Path)] = "sha256:" + digest
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), append(b, '\n'), 0644); err != nil {
+		klog.Fatalf("could not write %s: %v", filepath.Join(dir, "manifest.json"), err)
+	}
+}
+
+// manifestDigests returns the file names in dir of the digests of dir/manifest.json, the
+// artifacts of the last build stored in dir
+func manifestDigests(dir string) []string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		klog.Fatalf("could not read %s: %v", filepath.Join(dir, "manifest.json"), err)
+	}
+	manifest := map[string]string{}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		klog.Fatalf("could not parse %s: %v", filepath.Join(dir, "manifest.json"), err)
+	}
+	digests := []string{}
+	for _, d := range manifest {
+		digests = append(digests, strings.TrimPrefix(d, "sha256:"))
+	}
+	return digests
+}
+
+// fileDigest returns the hex encoded sha256 digest of the file at path
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s: %v", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFile copies src to dst, writing dst through a temporary file so it is never partially written
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %v", src, err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat %s: %v", src, err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst))
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", dst, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %v", dst, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %v", dst, err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return fmt.Errorf("could not write %s: %v", dst, err)
+	}
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var ccMap []string
+var cgoCflags string
+var cgoLdflags string
+
+// compilers returns the C compiler for each os/arch in --cc-map
+func compilers() map[string]string {
+	result := map[string]string{}
+	for _, entry := range ccMap {
+		kv := strings.SplitN(entry, "=", 2)
+		parts := strings.Split(kv[0], "/")
+		if len(kv) != 2 || len(kv[1]) == 0 || len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			klog.Fatalf("--cc-map entry %q must be of the form os/arch=compiler", entry)
+		}
+		result[kv[0]] = kv[1]
+	}
+	return result
+}
+
+// checkCompilers exits if a compiler in --cc-map can't be found.  --cc-map isn't used, or
+// checked, if every target is built with CGO_ENABLED=0.
+func checkCompilers() {
+	if len(ccMap) == 0 || !anyCgo() {
+		return
+	}
+	for p, cc := range compilers() {
+		if _, err := exec.LookPath(cc); err != nil {
+			klog.Fatalf("could not find the compiler %s for %s from --cc-map: %v", cc, p, err)
+		}
+	}
+}
+
+// anyCgo returns true if a target is built with cgo
+func anyCgo() bool {
+	env := userEnv()
+	for _, t := range resolveTargets() {
+		if cgoEnabled(t, env) {
+			return true
+		}
+	}
+	return false
+}
+
+// ccEnv returns the CC and CXX from --cc-map for building with cgo for the current platform
+func ccEnv() []string {
+	cc, found := compilers()[targetOS()+"/"+targetArch()]
+	if !found {
+		return []string{}
+	}
+	env := []string{"CC=" + cc}
+	if cxx := cxxCompiler(cc); len(cxx) > 0 {
+		env = append(env, "CXX="+cxx)
+	}
+	return env
+}
+
+// cxxCompiler returns the C++ compiler matching the C compiler cc, e.g. aarch64-linux-gnu-g++
+// for aarch64-linux-gnu-gcc, or nothing if it isn't gcc or clang
+func cxxCompiler(cc string) string {
+	dir, name := filepath.Split(cc)
+	switch {
+	case strings.HasSuffix(name, "gcc"):
+		return dir + strings.TrimSuffix(name, "gcc") + "g++"
+	case strings.HasSuffix(name, "clang"):
+		return dir + name + "++"
+	}
+	return ""
+}
+
+// cgoFlagsEnv returns the CGO_CFLAGS and CGO_LDFLAGS with the --cgo-cflags and --cgo-ldflags
+// appended to the values from env, or go env if env doesn't set them.  go env has the defaults,
+// e.g. -O2 -g, which setting the variables would drop otherwise.
+func cgoFlagsEnv(env []string) []string {
+	result := []string{}
+	for _, f := range []struct{ key, value string }{{"CGO_CFLAGS", cgoCflags}, {"CGO_LDFLAGS", cgoLdflags}} {
+		if len(f.value) == 0 {
+			continue
+		}
+		value := strings.TrimSpace(lastEnv(env, f.key, goEnv(f.key)) + " " + f.value)
+		result = append(result, f.key+"="+value)
+	}
+	return result
+}
+
+// warnCgoFlags warns if --cgo-cflags or --cgo-ldflags are set for target t built without cgo
+func warnCgoFlags(t buildTarget, env []string) {
+	if len(cgoCflags) == 0 && len(cgoLdflags) == 0 || cgoEnabled(t, env) {
+		return
+	}
+	klog.Warningf("Ignoring --cgo-cflags and --cgo-ldflags for %s, which is built with CGO_ENABLED=0.  "+
+		"Build with CGO_ENABLED=1 and --respect-cgo-env to build the apiserver with cgo.", t.Name)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var inContainer bool
+var builderImage string
+
+// containerPassEnv are the variables of the host passed to go in the --builder-image to download the modules
+var containerPassEnv = []string{"GOFLAGS", "GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB", "GOSUMDB", "GOINSECURE"}
+
+// containerCommand returns a docker run command running go with args in the --builder-image.  The project
+// root is mounted at /src, the output directory at /out and the host GOMODCACHE and GOCACHE are reused.
+// output is the path on the host go writes to, which is rewritten to its path under /out.  The env values
+// are passed through the environment of docker rather than its args, which are logged.
+func containerCommand(ctx context.Context, args []string, env []string, output string) *exec.Cmd {
+	root, err := projectRoot()
+	if err != nil {
+		klog.Fatalf("--in-container: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	rel, err := filepath.Rel(root, wd)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	out, err := filepath.Abs(outputdir)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	run := []string{"run", "--rm",
+		"-v", root + ":/src",
+		"-v", out + ":/out",
+		"-w", path.Join("/src", filepath.ToSlash(rel)),
+	}
+	if runtime.GOOS != "windows" {
+		// write the binaries as the host user
+		run = append(run, "-u", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()), "-e", "HOME=/tmp")
+	}
+	for _, v := range []string{"GOMODCACHE", "GOCACHE"} {
+		dir, err := exec.Command(goBinary(), "env", v).Output()
+		if err != nil || len(strings.TrimSpace(string(dir))) == 0 {
+			continue
+		}
+		run = append(run, "-v", strings.TrimSpace(string(dir))+":/"+strings.ToLower(v), "-e", v+"=/"+strings.ToLower(v))
+	}
+	passed := map[string]bool{}
+	for _, v := range containerPassEnv {
+		if value := os.Getenv(v); len(value) > 0 {
+			passed[v] = true
+			run = append(run, "-e", v)
+		}
+	}
+	for _, e := range env {
+		if k := strings.SplitN(e, "=", 2)[0]; !passed[k] {
+			passed[k] = true
+			run = append(run, "-e", k)
+		}
+	}
+	run = append(run, builderImage, "go")
+
+	for i, a := range args {
+		if a == output && i > 0 && args[i-1] == "-o" {
+			a = containerOutput(out, output)
+		}
+		run = append(run, a)
+	}
+	c := exec.CommandContext(ctx, "docker", run...)
+	c.Env = append(os.Environ(), env...)
+	return c
+}
+
+// checkInContainerFlags exits if a flag passing a host path go can't read in the --builder-image is set
+func checkInContainerFlags() {
+	if len(runtimeReplace) > 0 {
+		klog.Fatalf("--runtime-replace can't be used with --in-container, the go.mod replacing %s is a temporary file on the host", runtimeModule)
+	}
+	if len(ccMap) > 0 {
+		klog.Fatalf("--cc-map can't be used with --in-container, the compilers are on the host.  " +
+			"Install them in the --builder-image and set CC with --env.")
+	}
+	if filepath.IsAbs(buildTrace) {
+		klog.Fatalf("--build-trace %s must be relative to the working directory with --in-container, "+
+			"only the project root is mounted in the --builder-image", buildTrace)
+	}
+}
+
+// containerOutput returns the path under /out of the host path output in the output directory out
+func containerOutput(out, output string) string {
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	rel, err := filepath.Rel(out, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		klog.Fatalf("--in-container: %s is outside of the output directory %s", output, out)
+	}
+	p := path.Join("/out", filepath.ToSlash(rel))
+	if strings.HasSuffix(output, string(filepath.Separator)) {
+		p += "/"
+	}
+	return p
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var withConversionFuzz bool
+
+type conversionFuzzGroup struct {
+	Name     string
+	Internal *conversionFuzzPackage
+	Versions []conversionFuzzPackage
+}
+
+type conversionFuzzPackage struct {
+	Name  string
+	Alias string
+	Path  string
+}
+
+// runConversionFuzz runs a generated test round tripping fuzzed objects of each kind served by
+// more than one version of an API group through the other versions, and fails listing the
+// fields which don't survive the conversions registered by the AddToScheme of the versions
+func runConversionFuzz() {
+	groups := []conversionFuzzGroup{}
+	versions := map[string][]string{}
+	for _, api := range versionedAPIs {
+		group := filepath.Dir(api)
+		versions[group] = append(versions[group], filepath.Base(api))
+	}
+	for _, group := range unversionedAPIs {
+		if len(versions[group]) < 2 {
+			continue
+		}
+		g := conversionFuzzGroup{Name: group}
+		pkg := path.Join(util.GetRepo(), "pkg", "apis", filepath.ToSlash(group))
+		if hasAddToScheme(filepath.Join("pkg", "apis", group)) {
+			g.Internal = &conversionFuzzPackage{Name: "internal", Alias: aliasFor(group), Path: pkg}
+		}
+		for _, v := range versions[group] {
+			g.Versions = append(g.Versions, conversionFuzzPackage{Name: v, Alias: aliasFor(group + v), Path: path.Join(pkg, v)})
+		}
+		groups = append(groups, g)
+	}
+	if len(groups) == 0 {
+		klog.Infof("No API groups with more than one version, skipping --with-conversion-fuzz")
+		return
+	}
+
+	// the test must be in the module to import the API packages
+	dir, err := tempDir(".", "_apiserver-boot-conversion-fuzz-")
+	if err != nil {
+		klog.Fatalf("could not create a directory for the conversion fuzz test: %v", err)
+	}
+	util.WriteIfNotFound(filepath.Join(dir, "roundtrip_test.go"), "conversion-fuzz-template", conversionFuzzTemplate, groups)
+
+	// compiled first, so the test failing to compile isn't reported as a conversion failing
+	test := filepath.Join(dir, "conversionfuzz.test")
+	c := generateCommand(goBinary(), "test", "-c", "-o", test, "./"+filepath.ToSlash(dir))
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	if err := c.Run(); err != nil {
+		removeTempDir(dir)
+		if generateCtx.Err() != nil {
+			generateFailed("the --with-conversion-fuzz go test", err)
+		}
+		klog.Fatalf("--with-conversion-fuzz: the generated round trip test does not compile: %v", err)
+	}
+
+	c = generateCommand(test, "-test.count=1")
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	err = c.Run()
+	removeTempDir(dir)
+	if err != nil && generateCtx.Err() != nil {
+		generateFailed("the --with-conversion-fuzz go test", err)
+	}
+	if err != nil {
+		klog.Fatalf("--with-conversion-fuzz: conversions between API versions fail or lose data, the round trip test lists which: %v", err)
+	}
+}
+
+// hasAddToScheme returns true if a go file in dir declares AddToScheme
+func hasAddToScheme(dir string) bool {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			klog.Fatalf("could not read %s: %v", f, err)
+		}
+		if strings.Contains(string(b), "AddToScheme =") || strings.Contains(string(b), "func AddToScheme(") {
+			return true
+		}
+	}
+	return false
+}
+
+// aliasFor returns an identifier for importing the API package name
+func aliasFor(name string) string {
+	return strings.NewReplacer("-", "", ".", "", string(filepath.Separator), "").Replace(name)
+}
+
+var conversionFuzzTemplate = `// Code generated by apiserver-boot build executables --with-conversion-fuzz. DO NOT EDIT.
+
+package conversionfuzz
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/diff"
+{{ range . }}{{ if .Internal }}	{{ .Internal.Alias }} "{{ .Internal.Path }}"
+{{ end }}{{ range .Versions }}	{{ .Alias }} "{{ .Path }}"
+{{ end }}{{ end }})
+
+type apiPackage struct {
+	name        string
+	path        string
+	addToScheme func(*runtime.Scheme) error
+}
+
+type apiGroup struct {
+	name     string
+	internal *apiPackage
+	versions []apiPackage
+}
+
+var groups = []apiGroup{
+{{ range . }}	{
+		name: "{{ .Name }}",
+{{ if .Internal }}		internal: &apiPackage{"{{ .Internal.Name }}", "{{ .Internal.Path }}", {{ .Internal.Alias }}.AddToScheme},
+{{ end }}		versions: []apiPackage{
+{{ range .Versions }}			{"{{ .Name }}", "{{ .Path }}", {{ .Alias }}.AddToScheme},
+{{ end }}		},
+	},
+{{ end }}}
+
+// kinds returns the types of the kinds defined in the package at pkg
+func kinds(scheme *runtime.Scheme, pkg string) map[string]reflect.Type {
+	result := map[string]reflect.Type{}
+	for gvk, t := range scheme.AllKnownTypes() {
+		if t.PkgPath() == pkg && !strings.HasSuffix(gvk.Kind, "List") {
+			result[gvk.Kind] = t
+		}
+	}
+	return result
+}
+
+// convert converts in to out, through a new object of type via if it isn't nil
+func convert(scheme *runtime.Scheme, in, out interface{}, via reflect.Type) error {
+	if via == nil {
+		return scheme.Convert(in, out, nil)
+	}
+	hub := reflect.New(via).Interface()
+	if err := scheme.Convert(in, hub, nil); err != nil {
+		return err
+	}
+	return scheme.Convert(hub, out, nil)
+}
+
+func TestConversionRoundTrip(t *testing.T) {
+	for _, g := range groups {
+		scheme := runtime.NewScheme()
+		var internal map[string]reflect.Type
+		if g.internal != nil {
+			if err := g.internal.addToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, v := range g.versions {
+			if err := v.addToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if g.internal != nil {
+			internal = kinds(scheme, g.internal.path)
+		}
+		f := fuzzer.FuzzerFor(metafuzzer.Funcs, rand.NewSource(rand.Int63()), serializer.NewCodecFactory(scheme))
+
+		for _, a := range g.versions {
+			for kind, from := range kinds(scheme, a.path) {
+				for _, b := range g.versions {
+					to, found := kinds(scheme, b.path)[kind]
+					if b.path == a.path || !found {
+						continue
+					}
+					for i := 0; i < 20; i++ {
+						in := reflect.New(from).Interface()
+						f.Fuzz(in)
+						in.(runtime.Object).GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+						out := reflect.New(to).Interface()
+						back := reflect.New(from).Interface()
+						if err := convert(scheme, in, out, internal[kind]); err != nil {
+							t.Errorf("%s %s could not be converted %s -> %s: %v", g.name, kind, a.name, b.name, err)
+							break
+						}
+						if err := convert(scheme, out, back, internal[kind]); err != nil {
+							t.Errorf("%s %s could not be converted %s -> %s: %v", g.name, kind, b.name, a.name, err)
+							break
+						}
+						back.(runtime.Object).GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+						if !apiequality.Semantic.DeepEqual(in, back) {
+							t.Errorf("%s %s loses data in the round trip %s -> %s -> %s:\n%s", g.name, kind, a.name, b.name, a.name,
+								diff.ObjectReflectDiff(in, back))
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+}
+`
@@ -0,0 +1,81 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+var minDisk string
+
+// checkDiskSpace warns, or fails with --strict, if the output directory, GOCACHE or the bazel
+// output base have less than --min-disk free space, instead of the build failing with ENOSPC
+func checkDiskSpace() {
+	min, err := resource.ParseQuantity(minDisk)
+	if err != nil {
+		klog.Fatalf("invalid --min-disk %q: %v", minDisk, err)
+	}
+	if min.IsZero() {
+		return
+	}
+
+	dirs := map[string]string{"the output directory": outputdir}
+	if Bazel {
+		if out, err := exec.Command("bazel", bazelArgs("info", "output_base")...).Output(); err == nil {
+			dirs["the bazel output base"] = strings.TrimSpace(string(out))
+		}
+	} else if out, err := exec.Command(goBinary(), "env", "GOCACHE").Output(); err == nil && len(strings.TrimSpace(string(out))) > 0 {
+		dirs["GOCACHE"] = strings.TrimSpace(string(out))
+	}
+
+	for name, dir := range dirs {
+		free, err := freeDiskSpace(existingParent(dir))
+		if err != nil {
+			klog.Warningf("could not check the free disk space of %s %s: %v", name, dir, err)
+			continue
+		}
+		if free >= uint64(min.Value()) {
+			continue
+		}
+		if strict {
+			klog.Fatalf("%s %s has %s free disk space, less than --min-disk %s", name, dir,
+				resource.NewQuantity(int64(free), resource.BinarySI), minDisk)
+		}
+		klog.Warningf("%s %s has %s free disk space, less than --min-disk %s, the build may run out of space", name, dir,
+			resource.NewQuantity(int64(free), resource.BinarySI), minDisk)
+	}
+}
+
+// existingParent returns dir or its closest parent which exists
+func existingParent(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
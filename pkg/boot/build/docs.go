@@ -91,6 +91,7 @@ func AddDocs(cmd *cobra.Command) {
 	docsCmd.Flags().BoolVar(&generateToc, "generate-toc", true, "If true, generate the table of contents from the api groups instead of using a statically configured ToC.")
 	docsCmd.Flags().BoolVar(&disableDelegatedAuth, "disable-delegated-auth", true, "If true, disable delegated auth in the apiserver with --delegated-auth=false.")
 	docsCmd.Flags().StringVar(&outputDir, "output-dir", "docs", "Build docs into this directory")
+	docsCmd.PersistentFlags().BoolVar(&followSymlinks, "follow-symlinks", false, "If true, remove generated files through symlinked directories of the output directory, removing the files they link to")
 	cmd.AddCommand(docsCmd)
 	docsCmd.AddCommand(docsCleanCmd)
 }
@@ -104,9 +105,9 @@ var docsCleanCmd = &cobra.Command{
 }
 
 func RunCleanDocs(cmd *cobra.Command, args []string) {
-	os.RemoveAll(filepath.Join(outputDir, "build"))
-	os.RemoveAll(filepath.Join(outputDir, "includes"))
-	os.Remove(filepath.Join(outputDir, "manifest.json"))
+	removeAll(filepath.Join(outputDir, "build"))
+	removeAll(filepath.Join(outputDir, "includes"))
+	removeAll(filepath.Join(outputDir, "manifest.json"))
 }
 
 func RunDocs(cmd *cobra.Command, args []string) {
@@ -115,7 +116,7 @@ func RunDocs(cmd *cobra.Command, args []string) {
 		klog.Fatal("Must specifiy --server or --build-openapi=false")
 	}
 
-	os.RemoveAll(filepath.Join(outputDir, "includes"))
+	removeAll(filepath.Join(outputDir, "includes"))
 	os.MkdirAll(filepath.Join(outputDir, "openapi-spec"), 0700)
 	os.MkdirAll(filepath.Join(outputDir, "static_includes"), 0700)
 	os.MkdirAll(filepath.Join(outputDir, "examples"), 0700)
@@ -197,12 +198,12 @@ func RunDocs(cmd *cobra.Command, args []string) {
 
 	// Cleanup intermediate files
 	if cleanup {
-		os.RemoveAll(filepath.Join(wd, outputDir, "includes"))
-		os.RemoveAll(filepath.Join(wd, outputDir, "manifest.json"))
-		os.RemoveAll(filepath.Join(wd, outputDir, "openapi-spec"))
-		os.RemoveAll(filepath.Join(wd, outputDir, "build", "documents"))
-		os.RemoveAll(filepath.Join(wd, outputDir, "build", "runbrodocs.sh"))
-		os.RemoveAll(filepath.Join(wd, outputDir, "build", "node_modules", "marked", "Makefile"))
+		removeAll(filepath.Join(wd, outputDir, "includes"))
+		removeAll(filepath.Join(wd, outputDir, "manifest.json"))
+		removeAll(filepath.Join(wd, outputDir, "openapi-spec"))
+		removeAll(filepath.Join(wd, outputDir, "build", "documents"))
+		removeAll(filepath.Join(wd, outputDir, "build", "runbrodocs.sh"))
+		removeAll(filepath.Join(wd, outputDir, "build", "node_modules", "marked", "Makefile"))
 	}
 }
 
@@ -0,0 +1,83 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var embedDirs []string
+
+// prepareEmbedDirs makes sure the directories embedded with go:embed are in place before
+// building.  Each --embed-dir is either a directory which must exist and not be empty, or
+// src=dst to replace dst with a copy of src.
+func prepareEmbedDirs() {
+	for _, e := range embedDirs {
+		src, dst := e, e
+		if i := strings.Index(e, "="); i >= 0 {
+			src, dst = e[:i], e[i+1:]
+		}
+		files, err := ioutil.ReadDir(src)
+		if err != nil {
+			klog.Fatalf("--embed-dir %s: could not read embed directory %s: %v", e, src, err)
+		}
+		if len(files) == 0 {
+			klog.Fatalf("--embed-dir %s: embed directory %s is empty", e, src)
+		}
+		if src == dst {
+			continue
+		}
+
+		// dst is removed before copying, so it must be a directory of the project below its root
+		if clean := filepath.Clean(filepath.FromSlash(dst)); len(dst) == 0 || clean == "." || !insideDir(clean) {
+			klog.Fatalf("--embed-dir %s: %q must be a relative directory inside the project", e, dst)
+		}
+
+		if err := checkSymlinkOutput(dst); err != nil {
+			klog.Fatalf("--embed-dir %s: %v", e, err)
+		}
+
+		klog.Infof("Copying embed directory %s to %s", src, dst)
+		removeAll(dst)
+		if err := copyDir(src, dst); err != nil {
+			klog.Fatalf("--embed-dir %s: %v", e, err)
+		}
+	}
+}
+
+// copyDir copies the files under src to dst
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target)
+	})
+}
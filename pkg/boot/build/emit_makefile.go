@@ -0,0 +1,151 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var makefilePath string
+var makefileImage string
+var makefileForce bool
+
+var emitMakefileCmd = &cobra.Command{
+	Use:   "emit-makefile",
+	Short: "Write a Makefile building with the given build executables flags",
+	Long:  `Write a Makefile with build, build-all, docker and clean targets running apiserver-boot with the given build executables flags, so the build can be reproduced without remembering them`,
+	Example: `# Write a Makefile whose build target cross compiles with the version stamped into the binaries
+apiserver-boot build emit-makefile --goos linux --goarch arm64 --ldflags '-X main.version={{.Version}}'
+
+# Replace the Makefile, with a docker target building gcr.io/myrepo/myimage:mytag
+apiserver-boot build emit-makefile --force --image gcr.io/myrepo/myimage:mytag --trimpath`,
+	Run: RunEmitMakefile,
+}
+
+// AddEmitMakefile adds the emit-makefile command accepting the flags of build executables,
+// so it must be called after AddBuildExecutables
+func AddEmitMakefile(cmd *cobra.Command) {
+	cmd.AddCommand(emitMakefileCmd)
+
+	emitMakefileCmd.Flags().AddFlagSet(createBuildExecutablesCmd.Flags())
+	emitMakefileCmd.Flags().StringVar(&makefilePath, "makefile", "Makefile", "path of the Makefile to write")
+	emitMakefileCmd.Flags().StringVar(&makefileImage, "image", "", "default IMAGE the docker target builds")
+	emitMakefileCmd.Flags().BoolVar(&makefileForce, "force", false, "if true, replace the Makefile if it exists")
+}
+
+type makefileTemplateArguments struct {
+	Image      string
+	Flags      string
+	AllTargets string
+	Output     string
+}
+
+func RunEmitMakefile(cmd *cobra.Command, args []string) {
+	flags := passedFlags(cmd, map[string]bool{"makefile": true, "image": true, "force": true})
+
+	targets, err := projectTargets()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	all := []string{}
+	for _, t := range targets {
+		if t.Present {
+			all = append(all, t.Name)
+		}
+	}
+	if len(all) == 0 {
+		for _, t := range builtinTargets {
+			all = append(all, t.Name)
+		}
+	}
+
+	data := makefileTemplateArguments{
+		Image:      makeValue(makeQuote(makefileImage)),
+		Flags:      makeValue(makeQuote(flags...)),
+		AllTargets: makeQuote(strings.Join(all, ",")),
+		Output:     makeQuote(outputdir),
+	}
+	if makefileForce {
+		util.Overwrite(makefilePath, "makefile-template", makefileTemplate, data)
+	} else if !util.WriteIfNotFound(makefilePath, "makefile-template", makefileTemplate, data) {
+		klog.Fatalf("%s already exists, use --force to replace it", makefilePath)
+	}
+	klog.Infof("Wrote %s", makefilePath)
+}
+
+// passedFlags returns the --name=value args of the flags set on the command line except the
+// flags of the emitting command itself in own
+func passedFlags(cmd *cobra.Command, own map[string]bool) []string {
+	flags := []string{}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if own[f.Name] {
+			return
+		}
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range s.GetSlice() {
+				flags = append(flags, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		flags = append(flags, "--"+f.Name+"="+f.Value.String())
+	})
+	return flags
+}
+
+// makeQuote returns args quoted for the shell running a Makefile recipe
+func makeQuote(args ...string) string {
+	quoted := []string{}
+	for _, a := range args {
+		a = strings.ReplaceAll(a, "$", "$$")
+		if len(a) > 0 && !strings.ContainsAny(a, " \t'\"\\`|&;<>()*?[]#~!{}") {
+			quoted = append(quoted, a)
+			continue
+		}
+		quoted = append(quoted, "'"+strings.ReplaceAll(a, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
+
+// makeValue escapes the # of a variable value, which would start a comment.  Unlike a recipe,
+// make removes the backslash before passing the value to the shell.
+func makeValue(v string) string {
+	return strings.ReplaceAll(v, "#", `\#`)
+}
+
+var makefileTemplate = `# Generated by apiserver-boot build emit-makefile
+IMAGE ?= {{ .Image }}
+BUILD_FLAGS ?= {{ .Flags }}
+
+.PHONY: build build-all docker clean
+
+build:
+	apiserver-boot build executables $(BUILD_FLAGS)
+
+build-all:
+	apiserver-boot build executables $(BUILD_FLAGS) --targets {{ .AllTargets }}
+
+docker:
+	apiserver-boot build container --image $(IMAGE)
+
+clean:
+	rm -rf {{ .Output }}
+`
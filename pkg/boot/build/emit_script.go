@@ -0,0 +1,117 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var emitScript string
+
+// writeScript writes a script to --emit-script running the steps of the build plan with their
+// environment, a PowerShell script if it ends in .ps1 or the targets are built for windows
+func writeScript() {
+	wd, err := os.Getwd()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	powershell := strings.HasSuffix(emitScript, ".ps1") || targetOS() == "windows"
+	prevOS, prevArch := goos, goarch
+	steps := buildPlan()
+	goos, goarch = prevOS, prevArch
+
+	lines := []string{}
+	if powershell {
+		lines = append(lines,
+			"# Generated by apiserver-boot build executables --emit-script",
+			"$ErrorActionPreference = 'Stop'",
+			"Set-Location "+powershellQuote(wd))
+	} else {
+		lines = append(lines,
+			"#!/bin/sh",
+			"# Generated by apiserver-boot build executables --emit-script",
+			"set -e",
+			"cd "+shellQuote(wd))
+	}
+	for _, s := range steps {
+		header := "# " + s.Target
+		if len(s.Platform) > 0 {
+			header += " " + s.Platform
+		}
+		lines = append(lines, "", header)
+		dir := filepath.Dir(s.Output)
+		// the values of the secrets are left to the environment the script runs in
+		env := []string{}
+		for _, e := range s.Env {
+			if redactEnv(e) != e {
+				lines = append(lines, "# "+strings.SplitN(e, "=", 2)[0]+" is read from the environment, its value isn't written to the script")
+				continue
+			}
+			env = append(env, e)
+		}
+		if powershell {
+			lines = append(lines, "New-Item -ItemType Directory -Force -Path "+powershellQuote(dir)+" | Out-Null")
+			for _, e := range env {
+				kv := strings.SplitN(e, "=", 2)
+				lines = append(lines, "$env:"+kv[0]+" = "+powershellQuote(kv[1]))
+			}
+			args := []string{}
+			for _, a := range s.Command {
+				args = append(args, powershellQuote(a))
+			}
+			lines = append(lines, "& "+strings.Join(args, " "),
+				"if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }")
+			continue
+		}
+		lines = append(lines, "mkdir -p "+shellQuote(dir))
+		args := []string{}
+		if len(env) > 0 {
+			args = append(args, "env")
+			for _, e := range env {
+				args = append(args, shellQuote(e))
+			}
+		}
+		for _, a := range s.Command {
+			args = append(args, shellQuote(a))
+		}
+		lines = append(lines, strings.Join(args, " "))
+	}
+
+	if err := ioutil.WriteFile(emitScript, []byte(strings.Join(lines, "\n")+"\n"), 0755); err != nil {
+		klog.Fatalf("could not write --emit-script %s: %v", emitScript, err)
+	}
+	klog.Infof("Wrote the build commands to %s", emitScript)
+}
+
+// shellQuote returns s quoted for a POSIX shell
+func shellQuote(s string) string {
+	if len(s) > 0 && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// powershellQuote returns s as a PowerShell single quoted string
+func powershellQuote(s string) string {
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(s, "'", "''"))
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var tiltfilePath string
+var tiltImage string
+var tiltCluster string
+var tiltConfigDir string
+var tiltfileForce bool
+
+// tiltOutput is the directory the Tiltfile builds the binaries it syncs into the containers to
+var tiltOutput = filepath.Join("bin", "tilt")
+
+// tiltOwnFlags are the flags of build executables the Tiltfile sets itself, so the binaries
+// synced into the containers are where the live update expects them
+var tiltOwnFlags = map[string]bool{
+	"tiltfile": true, "image": true, "cluster": true, "config-dir": true, "force": true,
+	"goos": true, "goarch": true, "platforms": true, "output": true, "output-base": true,
+	"name-template": true, "output-template": true, "targets": true,
+}
+
+var emitTiltfileCmd = &cobra.Command{
+	Use:   "emit-tiltfile",
+	Short: "Write a Tiltfile for a dev loop building with the given build executables flags",
+	Long: `Write a Tiltfile building the binaries with the given build executables flags, building the image with build container, and deploying the build config to a local cluster.
+Changed binaries are synced into the running containers and restarted without rebuilding the image.  The Tiltfile is only written once, so it can be edited.`,
+	Example: `# Write a Tiltfile deploying example.io/myimage:dev to the kind cluster called dev
+apiserver-boot build config --name myapiserver --namespace default --image example.io/myimage:dev
+apiserver-boot build emit-tiltfile --image example.io/myimage:dev --cluster kind:dev
+tilt up
+
+# Replace the Tiltfile, building with trimpath
+apiserver-boot build emit-tiltfile --force --image example.io/myimage:dev --cluster minikube --trimpath`,
+	Run: RunEmitTiltfile,
+}
+
+// AddEmitTiltfile adds the emit-tiltfile command accepting the flags of build executables,
+// so it must be called after AddBuildExecutables
+func AddEmitTiltfile(cmd *cobra.Command) {
+	cmd.AddCommand(emitTiltfileCmd)
+
+	emitTiltfileCmd.Flags().AddFlagSet(createBuildExecutablesCmd.Flags())
+	emitTiltfileCmd.Flags().StringVar(&tiltfilePath, "tiltfile", "Tiltfile", "path of the Tiltfile to write")
+	emitTiltfileCmd.Flags().StringVar(&tiltImage, "image", "", "image the Tiltfile builds, the --image of the build config it deploys")
+	emitTiltfileCmd.Flags().StringVar(&tiltCluster, "cluster", "kind", "local cluster the Tiltfile deploys to, kind[:<cluster>] or minikube[:<profile>]")
+	emitTiltfileCmd.Flags().StringVar(&tiltConfigDir, "config-dir", "config", "directory of the build config manifests the Tiltfile deploys")
+	emitTiltfileCmd.Flags().BoolVar(&tiltfileForce, "force", false, "if true, replace the Tiltfile if it exists")
+}
+
+type tiltfileTemplateArguments struct {
+	Image      string
+	Context    string
+	ConfigDir  string
+	Flags      string
+	Targets    string
+	Deps       string
+	BinaryDeps string
+	Binaries   []tiltBinary
+}
+
+type tiltBinary struct {
+	Local  string
+	Remote string
+}
+
+func RunEmitTiltfile(cmd *cobra.Command, args []string) {
+	if len(tiltImage) == 0 {
+		klog.Fatalf("emit-tiltfile requires --image")
+	}
+	loadInto = tiltCluster
+	tool, cluster := loadTarget()
+	context := cluster
+	if tool == "kind" {
+		context = "kind-" + cluster
+	}
+
+	// the binaries of the image built by build container
+	targets := []string{}
+	binaries := []string{}
+	data := tiltfileTemplateArguments{
+		Image:     starlarkQuote(tiltImage),
+		Context:   starlarkQuote(context),
+		ConfigDir: starlarkQuote(filepath.ToSlash(tiltConfigDir)),
+		Flags:     starlarkQuote(passedFlags(cmd, tiltOwnFlags)...),
+	}
+	deps := []string{"go.mod", "go.sum", "pkg"}
+	for _, t := range builtinTargets {
+		if (t.Name != apiserverTarget && t.Name != controllerTarget && t.Name != migrateTarget) || !targetPresent(t) {
+			continue
+		}
+		targets = append(targets, t.Name)
+		deps = append(deps, filepath.ToSlash(t.Dir))
+		binaries = append(binaries, filepath.ToSlash(filepath.Join(tiltOutput, t.Binary)))
+		data.Binaries = append(data.Binaries, tiltBinary{
+			Local:  starlarkQuote(filepath.ToSlash(filepath.Join(tiltOutput, t.Binary))),
+			Remote: starlarkQuote("/" + t.Binary),
+		})
+	}
+	if len(targets) == 0 {
+		klog.Fatalf("emit-tiltfile found none of the %s, %s and %s targets to build", apiserverTarget, controllerTarget, migrateTarget)
+	}
+	existing := []string{}
+	for _, d := range deps {
+		if _, err := os.Stat(d); err == nil {
+			existing = append(existing, d)
+		}
+	}
+	data.Targets = starlarkQuote(strings.Join(targets, ","))
+	data.Deps = starlarkQuote(existing...)
+	data.BinaryDeps = starlarkQuote(binaries...)
+
+	if tiltfileForce {
+		util.Overwrite(tiltfilePath, "tiltfile-template", tiltfileTemplate, data)
+	} else if !util.WriteIfNotFound(tiltfilePath, "tiltfile-template", tiltfileTemplate, data) {
+		klog.Fatalf("%s already exists, use --force to replace it", tiltfilePath)
+	}
+	if _, err := os.Stat(tiltConfigDir); err != nil {
+		klog.Warningf("%s doesn't exist, write the manifests the Tiltfile deploys with "+
+			"apiserver-boot build config --name <name> --namespace <namespace> --image %s", tiltConfigDir, tiltImage)
+	}
+	klog.Infof("Wrote %s, run it with tilt up", tiltfilePath)
+}
+
+// starlarkQuote returns args as comma separated Starlark string literals
+func starlarkQuote(args ...string) string {
+	quoted := []string{}
+	for _, a := range args {
+		quoted = append(quoted, strconv.Quote(a))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+var tiltfileTemplate = `# Generated by apiserver-boot build emit-tiltfile, edit it to fit your dev loop.
+#
+# The binaries are built for linux/amd64 into bin/tilt, the image is built with
+# apiserver-boot build container, and the manifests of apiserver-boot build config are
+# deployed.  When only the binaries change they are synced into the running containers,
+# and restarted by the shell loop the containers run them in, without rebuilding the image.
+# The loop needs a shell in the image, so this doesn't work with the distroless static image.
+
+allow_k8s_contexts({{ .Context }})
+
+IMAGE = {{ .Image }}
+CONFIG_DIR = {{ .ConfigDir }}
+BUILD_FLAGS = [{{ .Flags }}]
+
+# restarts the binary, passed as $0, whenever it exits, e.g. when killed after a live update
+RESTART_LOOP = 'while true; do "$0" "$@" & echo $! > /tmp/apiserver-boot.pid; wait $!; done'
+
+local_resource(
+    'executables',
+    cmd=['apiserver-boot', 'build', 'executables', '--goos', 'linux', '--goarch', 'amd64',
+         '--output', 'bin/tilt', '--targets', {{ .Targets }}] + BUILD_FLAGS,
+    deps=[{{ .Deps }}],
+    ignore=['bin'],
+    labels=['build'],
+)
+
+custom_build(
+    IMAGE,
+    'apiserver-boot build container --image $EXPECTED_REF --targets ' + {{ .Targets }},
+    deps=[{{ .BinaryDeps }}],
+    live_update=[
+{{- range .Binaries }}
+        sync({{ .Local }}, {{ .Remote }}),
+{{- end }}
+        run('kill $(cat /tmp/apiserver-boot.pid)'),
+    ],
+)
+
+def dev_loop_manifests():
+    """Returns the manifests of CONFIG_DIR, running the binaries of IMAGE in RESTART_LOOP."""
+    if not os.path.exists(CONFIG_DIR):
+        fail('%s doesn\'t exist, write it with apiserver-boot build config --image %s' % (CONFIG_DIR, IMAGE))
+    objects = []
+    for f in listdir(CONFIG_DIR):
+        if f.endswith('.yaml'):
+            objects.extend(decode_yaml_stream(read_file(f)))
+    for o in objects:
+        if o.get('kind') not in ['Deployment', 'StatefulSet']:
+            continue
+        for c in o['spec']['template']['spec']['containers']:
+            if c.get('image') == IMAGE and c.get('command'):
+                c['command'] = ['sh', '-c', RESTART_LOOP] + c['command']
+    return encode_yaml_stream(objects)
+
+k8s_yaml(dev_loop_manifests())
+`
@@ -0,0 +1,158 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var envFile string
+var buildEnv []string
+var goproxy string
+var goproxyOff bool
+
+// goEnvValues caches the values returned by goEnv
+var goEnvValues = map[string]string{}
+
+// goEnv returns the value of the go environment variable key, the default of go if it isn't
+// set, or nothing if go env fails
+func goEnv(key string) string {
+	if v, found := goEnvValues[key]; found {
+		return v
+	}
+	out, err := exec.Command(goBinary(), "env", key).Output()
+	if err != nil {
+		klog.Warningf("could not run go env %s: %v", key, err)
+	}
+	goEnvValues[key] = strings.TrimSpace(string(out))
+	return goEnvValues[key]
+}
+
+// goAtLeast returns true if the go building the targets is at least go1.minor.  Development
+// versions are assumed to be recent.
+func goAtLeast(minor int) bool {
+	v := goEnv("GOVERSION")
+	if !strings.HasPrefix(v, "go1.") {
+		return true
+	}
+	v = strings.TrimPrefix(v, "go1.")
+	if i := strings.IndexFunc(v, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		v = v[:i]
+	}
+	n, err := strconv.Atoi(v)
+	return err != nil || n >= minor
+}
+
+// userEnv returns the GOPROXY from --goproxy, --goproxy-off, --offline or --mod followed by the KEY=VALUE
+// entries from --env-file and the --env entries, so the explicit --env values win when
+// appended to a command's environment.
+func userEnv() []string {
+	env := proxyEnv()
+	if len(envFile) > 0 {
+		fileEnv, err := readEnvFile(envFile)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		env = append(env, fileEnv...)
+	}
+	for _, e := range buildEnv {
+		if !strings.Contains(e, "=") {
+			klog.Fatalf("--env %q must be of the form KEY=VALUE", e)
+		}
+		env = append(env, e)
+	}
+	return env
+}
+
+// readEnvFile parses a dotenv style file of KEY=VALUE lines.  Blank lines and
+// lines starting with # are ignored, and values may be wrapped in quotes.
+func readEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read env file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	env := []string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || len(key) == 0 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE, got %q", path, n, line)
+		}
+		value := strings.TrimSpace(kv[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env = append(env, key+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read env file %s: %v", path, err)
+	}
+	return env, nil
+}
+
+// proxyEnv returns the environment selecting the module proxy for --goproxy, --goproxy-off and
+// --offline.  Vendored builds never use a proxy.
+func proxyEnv() []string {
+	if offline {
+		return offlineEnv()
+	}
+	if goproxyOff && len(goproxy) > 0 {
+		klog.Fatalf("only one of --goproxy and --goproxy-off may be set")
+	}
+	switch {
+	case goproxyOff && len(modMode) == 0:
+		return []string{"GOFLAGS=" + mergeGoflags(os.Getenv("GOFLAGS"), "-mod=mod"), "GOPROXY=off"}
+	case goproxyOff || modMode == "vendor":
+		return []string{"GOPROXY=off"}
+	case len(goproxy) > 0:
+		return []string{"GOPROXY=" + goproxy}
+	}
+	return []string{}
+}
+
+// mergeGoflags returns the GOFLAGS value goflags with each of add added once, replacing the
+// flags of goflags setting the same flag, e.g. -mod=readonly for -mod=mod
+func mergeGoflags(goflags string, add ...string) string {
+	replaced := map[string]bool{}
+	for _, a := range add {
+		replaced[strings.SplitN(a, "=", 2)[0]] = true
+	}
+	flags := []string{}
+	seen := map[string]bool{}
+	for _, f := range strings.Fields(goflags) {
+		if replaced[strings.SplitN(f, "=", 2)[0]] || seen[f] {
+			continue
+		}
+		seen[f] = true
+		flags = append(flags, f)
+	}
+	return strings.Join(append(flags, add...), " ")
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"k8s.io/klog/v2"
+)
+
+var explain string
+
+// targetDecision is why build executables builds or skips a target, printed by --explain
+type targetDecision struct {
+	Target string `json:"target"`
+	Built  bool   `json:"built"`
+	Reason string `json:"reason"`
+}
+
+// explainTargets returns the decision for each target of the project and each selected target
+func explainTargets() []targetDecision {
+	targets, err := projectTargets()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	selected := map[string]bool{}
+	for _, t := range resolveTargets() {
+		selected[t.Name] = true
+	}
+	// the uncommitted changes, none outside of a git working tree
+	changed, _ := changedDirs("HEAD")
+
+	decisions := []targetDecision{}
+	for _, t := range targets {
+		d := targetDecision{Target: t.Name}
+		bt, _ := lookupTarget(t.Name)
+		switch {
+		case !t.Present && bt.Test:
+			d.Reason = "skipped: no " + t.Source + " directory"
+		case !t.Present:
+			d.Reason = "skipped: no " + filepath.ToSlash(filepath.Join(t.Source, "main.go"))
+		case buildMode == "plugin":
+			d.Reason = "skipped: --buildmode=plugin builds --plugin-package instead of the targets"
+		case !selected[t.Name]:
+			d.Reason = "skipped: not selected by --targets"
+		case targetChanged(t, changed):
+			d.Built, d.Reason = true, "built: selected by --targets, source changed since HEAD"
+		default:
+			d.Built, d.Reason = true, "built: selected by --targets"
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+// writeExplain writes the decision for each target to w as text or json for --explain
+func writeExplain(w io.Writer) {
+	decisions := explainTargets()
+	switch explain {
+	case "json":
+		b, err := json.MarshalIndent(decisions, "", "  ")
+		if err != nil {
+			klog.Fatal(err)
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			klog.Fatal(err)
+		}
+	case "text":
+		for _, d := range decisions {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", d.Target, d.Reason); err != nil {
+				klog.Fatal(err)
+			}
+		}
+	default:
+		klog.Fatalf("--explain must be text or json, got %q", explain)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var featureGates []string
+var featureGatesPackage string
+
+// defaultFeatureGates is the value of the defaultFeatureGates variable of --feature-gates-package
+// checked by checkFeatureGates, e.g. AlphaThing=true,BetaThing=false
+var defaultFeatureGates string
+
+// featureDecl matches the declarations of the featuregate.Feature names of a features package
+var featureDecl = regexp.MustCompile(`\w+\s+featuregate\.Feature\s*=\s*"([^"]+)"`)
+
+// featureGatesPkg returns --feature-gates-package, or the pkg/features package of the module
+func featureGatesPkg() string {
+	if len(featureGatesPackage) > 0 {
+		return featureGatesPackage
+	}
+	return path.Join(util.GetRepo(), "pkg", "features")
+}
+
+// checkFeatureGates exits if the --feature-gates aren't <name>=<bool> settings of the features
+// declared by --feature-gates-package, and sets defaultFeatureGates
+func checkFeatureGates() {
+	pkg := featureGatesPkg()
+	c := exec.Command(goBinary(), "list", "-f", "{{ .Dir }}", pkg)
+	c.Env = append(os.Environ(), userEnv()...)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		klog.Fatalf("--feature-gates-package %s is not importable: %s", pkg, strings.TrimSpace(string(out)))
+	}
+	known := map[string]bool{}
+	files, _ := filepath.Glob(filepath.Join(strings.TrimSpace(string(out)), "*.go"))
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			klog.Fatalf("could not read %s: %v", f, err)
+		}
+		for _, m := range featureDecl.FindAllStringSubmatch(string(b), -1) {
+			known[m[1]] = true
+		}
+	}
+	names := []string{}
+	for k := range known {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	gates := map[string]bool{}
+	for _, s := range featureGates {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			klog.Fatalf("--feature-gates %q must be <name>=true or <name>=false", s)
+		}
+		if !known[kv[0]] {
+			klog.Fatalf("--feature-gates %s is not a featuregate.Feature declared by %s, must be one of %q", kv[0], pkg, names)
+		}
+		enabled, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			klog.Fatalf("--feature-gates %s must be true or false, got %q", kv[0], kv[1])
+		}
+		if prev, found := gates[kv[0]]; found && prev != enabled {
+			klog.Fatalf("--feature-gates sets %s more than once", kv[0])
+		}
+		gates[kv[0]] = enabled
+	}
+	settings := []string{}
+	for name, enabled := range gates {
+		settings = append(settings, name+"="+strconv.FormatBool(enabled))
+	}
+	sort.Strings(settings)
+	defaultFeatureGates = strings.Join(settings, ",")
+
+	if !buildApiserver() && len(targetGroups()) == 0 {
+		klog.Warningf("--feature-gates has no effect without an %s target", apiserverTarget)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var fips bool
+
+// boringSymbol is in the names of the cgo functions calling BoringCrypto, linked only with
+// GOEXPERIMENT=boringcrypto
+const boringSymbol = "_goboringcrypto_"
+
+// checkFIPSFlags exits if --fips is set for a platform or with flags BoringCrypto can't be built for
+func checkFIPSFlags() {
+	for _, p := range buildPlatforms() {
+		goos, goarch := p.OS, p.Arch
+		if len(goos) == 0 {
+			goos = targetOS()
+		}
+		if len(goarch) == 0 {
+			goarch = targetArch()
+		}
+		if goos != "linux" || goarch != "amd64" {
+			klog.Fatalf("--fips: BoringCrypto can only be built for linux/amd64, not %s/%s", goos, goarch)
+		}
+	}
+	if strip {
+		klog.Fatalf("--fips can't be used with --strip, the binaries need their symbol table for go tool nm to verify BoringCrypto is linked")
+	}
+	if buildMode == "plugin" {
+		klog.Fatalf("--fips can't be used with --buildmode plugin, the plugin is linked with the crypto of the apiserver loading it")
+	}
+	if lastEnv(userEnv(), "CGO_ENABLED", "") == "0" {
+		klog.Fatalf("--fips can't be used with CGO_ENABLED=0 in --env or --env-file, BoringCrypto is linked with cgo")
+	}
+}
+
+// fipsEnv returns the GOEXPERIMENT building with BoringCrypto, keeping the experiments set in env
+// or the environment
+func fipsEnv(env []string) []string {
+	experiments := []string{}
+	for _, e := range strings.Split(lastEnv(env, "GOEXPERIMENT", os.Getenv("GOEXPERIMENT")), ",") {
+		if len(e) > 0 && e != "boringcrypto" {
+			experiments = append(experiments, e)
+		}
+	}
+	return []string{"GOEXPERIMENT=" + strings.Join(append(experiments, "boringcrypto"), ",")}
+}
+
+// checkFIPSBinary returns an error if the binary at path doesn't link BoringCrypto
+func checkFIPSBinary(path string) error {
+	c := exec.Command(goBinary(), "tool", "nm", path)
+	klog.Infof("%s", strings.Join(displayArgs(c.Args), " "))
+	c.Stderr = util.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return fmt.Errorf("--fips: could not list the symbols of %s, was it linked with -s?: %v", path, err)
+	}
+	if !bytes.Contains(out, []byte(boringSymbol)) {
+		return fmt.Errorf("--fips: %s does not link BoringCrypto, no %s symbols.  Does %s support GOEXPERIMENT=boringcrypto, and does the binary use crypto?",
+			path, boringSymbol, goBinary())
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var withCRDs bool
+var crdDir string
+var verifyGenerated bool
+var withProto bool
+var protocPath string
+var generateTimeout time.Duration
+
+// generateCtx is the context of the commands run by the code generation, cancelled after --generate-timeout
+var generateCtx = context.Background()
+
+// runGenerate runs the code generation of initApis and --verify-rbac within --generate-timeout
+func runGenerate() {
+	if generateTimeout > 0 {
+		var cancel context.CancelFunc
+		generateCtx, cancel = context.WithTimeout(context.Background(), generateTimeout)
+		defer cancel()
+	}
+	// the markers are outside of pkg/apis, so --generate-if-stale doesn't skip the check
+	if verifyRBAC {
+		checkRBAC()
+	}
+	if !generateIfStale {
+		initApis()
+	} else if reason := generateStale(); len(reason) > 0 {
+		klog.Infof("Running the code generation for --generate-if-stale, %s", reason)
+		initApis()
+		writeGenerateStamp()
+	} else {
+		klog.Infof("Skipping the code generation for --generate-if-stale, the API types under pkg/apis and the generation flags " +
+			"didn't change since it last ran")
+		if reportUnusedGenerated || pruneGenerated {
+			klog.Infof("Skipping --report-unused-generated, which compares the files written by the code generation with the files on disk")
+		}
+		return
+	}
+	if reportUnusedGenerated || pruneGenerated {
+		reportOrphans()
+	}
+}
+
+// generateCommand returns a command of the code generation, killed after --generate-timeout
+func generateCommand(name string, args ...string) *exec.Cmd {
+	c := exec.CommandContext(generateCtx, name, args...)
+	c.Stderr = util.Stderr
+	c.Stdout = util.Stdout
+	return c
+}
+
+// runGenerateCommand runs the code generation command name and exits if it fails
+func runGenerateCommand(name string, args ...string) {
+	c := generateCommand(name, args...)
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	if err := c.Run(); err != nil {
+		generateFailed(name, err)
+	}
+}
+
+// generateFailed exits reporting that the code generation command name failed with err,
+// or was killed by --generate-timeout
+func generateFailed(name string, err error) {
+	if generateCtx.Err() == context.DeadlineExceeded {
+		klog.Fatalf("code generation timed out after --generate-timeout %v, killed %s.  "+
+			"The targets weren't built.", generateTimeout, name)
+	}
+	klog.Fatalf("%s failed: %v", name, err)
+}
+
+// crdMarker marks a type which is served as a CustomResourceDefinition instead of by the apiserver
+const crdMarker = "+kubebuilder:resource"
+
+// generateCRDs runs controller-gen to write the CRD manifests for the API versions
+// containing types with the crdMarker
+func generateCRDs() {
+	paths := []string{}
+	for _, api := range versionedAPIs {
+		if hasMarker(filepath.Join("pkg", "apis", api), crdMarker) {
+			paths = append(paths, "paths=./"+filepath.ToSlash(filepath.Join("pkg", "apis", api)))
+		}
+	}
+	if len(paths) == 0 {
+		klog.Infof("No types with %s found under pkg/apis, skipping CRD generation", crdMarker)
+		return
+	}
+	if _, err := exec.LookPath("controller-gen"); err != nil {
+		klog.Fatalf("--with-crds requires controller-gen, install it with " +
+			"`go install sigs.k8s.io/controller-tools/cmd/controller-gen@latest`")
+	}
+	args := append([]string{"crd"}, paths...)
+	runGenerateCommand("controller-gen", append(args, "output:crd:artifacts:config="+crdDir)...)
+}
+
+// hasMarker returns true if a go file in dir contains the comment marker
+func hasMarker(dir, marker string) bool {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		klog.Fatalf("could not read %s: %v", dir, err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".go") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			klog.Fatalf("could not read %s: %v", filepath.Join(dir, f.Name()), err)
+		}
+		if bytes.Contains(b, []byte("// "+marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGenerated regenerates the deepcopy code of the API versions into a temporary directory
+// with controller-gen and fails listing the checked-in generated files which differ from it
+func checkGenerated() {
+	if _, err := exec.LookPath("controller-gen"); err != nil {
+		klog.Fatalf("--verify-generated requires controller-gen, install it with " +
+			"`go install sigs.k8s.io/controller-tools/cmd/controller-gen@latest`")
+	}
+	tmp, err := tempDir("", "apiserver-boot-verify-")
+	if err != nil {
+		klog.Fatalf("could not create a directory to generate code into: %v", err)
+	}
+	defer removeTempDir(tmp)
+
+	stale := []string{}
+	for _, api := range versionedAPIs {
+		dir := filepath.Join("pkg", "apis", api)
+		out := filepath.Join(tmp, api)
+		args := []string{"object"}
+		if _, err := os.Stat(filepath.Join("hack", "boilerplate.go.txt")); err == nil {
+			args = append(args, "object:headerFile="+filepath.Join("hack", "boilerplate.go.txt"))
+		}
+		args = append(args, "paths=./"+filepath.ToSlash(dir), "output:object:dir="+out)
+		runGenerateCommand("controller-gen", args...)
+
+		files, err := ioutil.ReadDir(out)
+		if err != nil {
+			// nothing to generate for this version
+			continue
+		}
+		for _, f := range files {
+			want, err := ioutil.ReadFile(filepath.Join(out, f.Name()))
+			if err != nil {
+				klog.Fatalf("could not read %s: %v", filepath.Join(out, f.Name()), err)
+			}
+			got, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+			if err != nil || !bytes.Equal(got, want) {
+				stale = append(stale, filepath.Join(dir, f.Name()))
+			}
+		}
+	}
+	if len(stale) > 0 {
+		klog.Fatalf("generated code is out of date, regenerate it with `make generate`:\n  %s",
+			strings.Join(stale, "\n  "))
+	}
+	klog.Infof("Generated code is up to date")
+}
+
+// generateProto runs go-to-protobuf to write the .proto and generated.pb.go files of the API
+// versions and add the protobuf tags to their types
+func generateProto() {
+	protoc, err := exec.LookPath(protocPath)
+	if err != nil {
+		klog.Fatalf("--with-proto requires protoc, install it from https://github.com/protocolbuffers/protobuf/releases "+
+			"or set its path with --protoc: %v", err)
+	}
+	for _, bin := range []string{"go-to-protobuf", "protoc-gen-gogo"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			klog.Fatalf("--with-proto requires %s, install it with "+
+				"`go install k8s.io/code-generator/cmd/go-to-protobuf/...@latest`", bin)
+		}
+	}
+	if len(versionedAPIs) == 0 {
+		klog.Infof("No API versions found under pkg/apis, skipping protobuf generation")
+		return
+	}
+
+	// go-to-protobuf writes to <output-base>/<package path>, so link the project there
+	wd, err := os.Getwd()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	base, err := tempDir("", "apiserver-boot-proto-")
+	if err != nil {
+		klog.Fatalf("could not create a directory to generate protobuf into: %v", err)
+	}
+	defer removeTempDir(base)
+	repo := filepath.Join(base, filepath.FromSlash(util.GetRepo()))
+	if err := os.MkdirAll(filepath.Dir(repo), 0700); err != nil {
+		klog.Fatal(err)
+	}
+	if err := os.Symlink(wd, repo); err != nil {
+		klog.Fatal(err)
+	}
+
+	packages := []string{}
+	for _, api := range versionedAPIs {
+		packages = append(packages, util.GetRepo()+"/"+filepath.ToSlash(filepath.Join("pkg", "apis", api)))
+	}
+	args := []string{
+		"--packages=" + strings.Join(packages, ","),
+		"--output-base=" + base,
+	}
+	if _, err := os.Stat(filepath.Join("hack", "boilerplate.go.txt")); err == nil {
+		args = append(args, "--go-header-file="+filepath.Join(wd, "hack", "boilerplate.go.txt"))
+	}
+	if len(vendorDir) > 0 {
+		args = append(args, "--proto-import="+vendorDir)
+	}
+	c := generateCommand("go-to-protobuf", args...)
+	// go-to-protobuf runs the protoc from the PATH
+	c.Env = append(os.Environ(), "PATH="+filepath.Dir(protoc)+string(os.PathListSeparator)+os.Getenv("PATH"))
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	if err := c.Run(); err != nil {
+		generateFailed("go-to-protobuf", err)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var githubOutput string
+
+// outputNameChars matches the characters which aren't allowed in a step output name
+var outputNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// writeGithubOutput appends an artifact_<target>=<path> line for each binary to the GitHub
+// Actions output file from --github-output or $GITHUB_OUTPUT.  Binaries built with
+// --platforms are named artifact_<target>_<os>_<arch>, and the binaries of the test target,
+// one per package, artifact_test-binaries_<package>[_<os>_<arch>].
+func writeGithubOutput() {
+	path := githubOutput
+	if len(path) == 0 {
+		path = os.Getenv("GITHUB_OUTPUT")
+	}
+	if len(path) == 0 {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		klog.Fatalf("could not open the GitHub Actions output %s: %v", path, err)
+	}
+	defer f.Close()
+	for _, a := range artifacts {
+		name := "artifact_" + a.Target
+		if a.Target == testTarget {
+			name += "_" + strings.TrimSuffix(filepath.Base(a.Path), ".test")
+		}
+		if len(platforms) > 0 {
+			name = fmt.Sprintf("%s_%s_%s", name, a.OS, a.Arch)
+		}
+		if _, err := fmt.Fprintf(f, "%s=%s\n", outputNameChars.ReplaceAllString(name, "_"), a.Path); err != nil {
+			klog.Fatalf("could not write the GitHub Actions output %s: %v", path, err)
+		}
+	}
+}
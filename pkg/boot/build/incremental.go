@@ -0,0 +1,221 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var incremental bool
+
+// incrementalKeysFile is the file in the output directory mapping the binaries built with
+// --incremental to the keys of the builds they were built by
+const incrementalKeysFile = ".apiserver-boot-build-keys.json"
+
+// listedPackage is the part of the go list -json output of a package the build key hashes
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	Standard   bool
+	Module     *struct {
+		Main    bool
+		Path    string
+		Version string
+		Replace *struct {
+			Path    string
+			Version string
+		}
+	}
+	GoFiles, CgoFiles, CFiles, CXXFiles, HFiles, SFiles, SysoFiles, EmbedFiles []string
+}
+
+// buildKey returns the key of building target t with the extra environment env: a hash of the
+// go version, the go build args, the go env the build runs with, and the sources of the packages
+// the target imports.  The packages of module versions are hashed by their version, the others by
+// the content of their files.  A binary built with the same key is the binary the build would write.
+func buildKey(t buildTarget, env []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "go %s\n", goEnv("GOVERSION"))
+
+	args := []string{}
+	for _, a := range goBuildArgs(t)[1:] {
+		// the trace file of go build isn't part of the build, and go list would overwrite it
+		if !strings.HasPrefix(a, "-debug-trace=") {
+			args = append(args, a)
+		}
+	}
+	fmt.Fprintf(h, "args %q\n", args)
+
+	c := exec.Command(goBinary(), "env", "-json")
+	c.Env = append(os.Environ(), targetEnv(t, env)...)
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("could not run go env for %s: %v", t.Name, err)
+	}
+	goenv := map[string]string{}
+	if err := json.Unmarshal(out, &goenv); err != nil {
+		return "", fmt.Errorf("could not parse the go env of %s: %v", t.Name, err)
+	}
+	// GOGCCFLAGS has the random temporary directory of the go command
+	delete(goenv, "GOGCCFLAGS")
+	b, err := json.Marshal(goenv)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "env %s\n", b)
+
+	c = exec.Command(goBinary(), append(append([]string{"list", "-deps", "-json"}, args...), "./"+filepath.ToSlash(t.Dir))...)
+	c.Env = append(os.Environ(), targetEnv(t, env)...)
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	out, err = c.Output()
+	if err != nil {
+		return "", fmt.Errorf("could not list the packages of %s: %v: %s", t.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		p := listedPackage{}
+		if err := dec.Decode(&p); err != nil {
+			return "", fmt.Errorf("could not parse the packages of %s: %v", t.Name, err)
+		}
+		if p.Standard {
+			continue
+		}
+		if m := p.Module; m != nil && !m.Main && (m.Replace == nil || len(m.Replace.Version) > 0) {
+			v := m.Path + "@" + m.Version
+			if m.Replace != nil {
+				v += "=>" + m.Replace.Path + "@" + m.Replace.Version
+			}
+			fmt.Fprintf(h, "package %s %s\n", p.ImportPath, v)
+			continue
+		}
+		fmt.Fprintf(h, "package %s\n", p.ImportPath)
+		for _, files := range [][]string{p.GoFiles, p.CgoFiles, p.CFiles, p.CXXFiles, p.HFiles, p.SFiles, p.SysoFiles, p.EmbedFiles} {
+			for _, name := range files {
+				if err := hashFile(h, filepath.Join(p.Dir, name)); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile writes the name and content of the file at path to h
+func hashFile(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %v", path, err)
+	}
+	defer f.Close()
+	fmt.Fprintf(h, "file %s\n", filepath.ToSlash(path))
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return nil
+}
+
+// builtBinary is the entry of a binary of the output directory built with --incremental
+type builtBinary struct {
+	// Key is the buildKey of the build which wrote the binary
+	Key string `json:"key"`
+	// Digest is the sha256 digest of the binary, which is rebuilt if it was changed since
+	Digest string `json:"digest"`
+}
+
+// readBuildKeys returns the binaries in the output directory built with --incremental, by their
+// path relative to it
+func readBuildKeys() map[string]builtBinary {
+	keys := map[string]builtBinary{}
+	b, err := ioutil.ReadFile(filepath.Join(outputdir, incrementalKeysFile))
+	if os.IsNotExist(err) {
+		return keys
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &keys)
+	}
+	if err != nil {
+		klog.Warningf("--incremental: ignoring %s, rebuilding all targets: %v", filepath.Join(outputdir, incrementalKeysFile), err)
+		return map[string]builtBinary{}
+	}
+	return keys
+}
+
+// writeBuildKeys writes the binaries in the output directory built with --incremental
+func writeBuildKeys(keys map[string]builtBinary) {
+	b, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outputdir, incrementalKeysFile), append(b, '\n'), 0644); err != nil {
+		klog.Fatalf("could not write %s: %v", filepath.Join(outputdir, incrementalKeysFile), err)
+	}
+}
+
+// forgetBuildKeys removes the --incremental keys of the output directory when binaries are
+// installed into it without --incremental, which may replace the binaries they describe
+func forgetBuildKeys(dir string) {
+	if err := os.Remove(filepath.Join(dir, incrementalKeysFile)); err != nil && !os.IsNotExist(err) {
+		klog.Fatalf("could not remove %s: %v", filepath.Join(dir, incrementalKeysFile), err)
+	}
+}
+
+// stagedKey returns the relative path of the staged binary of target t, which is its path in the
+// output directory too
+func stagedKey(t buildTarget) string {
+	rel, err := filepath.Rel(stageDir, targetOutput(t))
+	if err != nil {
+		klog.Fatal(err)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// reuseBinary stages the binary of target t installed in the output directory instead of building
+// it, if it is unchanged since it was built with key.  It returns false if the target has to be built.
+func reuseBinary(t buildTarget, keys map[string]builtBinary, key string) bool {
+	built, found := keys[stagedKey(t)]
+	if !found || built.Key != key {
+		return false
+	}
+	installed := filepath.Join(outputdir, filepath.FromSlash(stagedKey(t)))
+	if digest, err := fileDigest(installed); err != nil || digest != built.Digest {
+		return false
+	}
+	output := targetOutput(t)
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		klog.Fatalf("could not create %s: %v", filepath.Dir(output), err)
+	}
+	if err := copyFile(installed, output); err != nil {
+		klog.Warningf("--incremental: rebuilding %s%s: %v", t.Name, platformSuffix(), err)
+		return false
+	}
+	klog.Infof("%s%s is up to date, reusing %s", t.Name, platformSuffix(), displayPath(installed))
+	staged = append(staged, artifact{Target: t.Name, Path: output, OS: targetOS(), Arch: targetArch()})
+	return true
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var k8sMatrix []string
+
+// apimachineryModule is the module the --k8s-matrix versions are for
+const apimachineryModule = "k8s.io/apimachinery"
+
+// runK8sMatrix builds the apiserver targets against each --k8s-matrix version of k8s.io/apimachinery
+// and exits listing the versions which failed to compile.  The k8s.io modules required at the same
+// version as k8s.io/apimachinery, e.g. k8s.io/api and k8s.io/client-go, are released together and
+// replaced with the same version.  Each build uses a copy of go.mod and its own module cache.
+func runK8sMatrix() {
+	b, err := ioutil.ReadFile("go.mod")
+	if err != nil {
+		klog.Fatalf("--k8s-matrix requires a go.mod: %v", err)
+	}
+	mod, err := modfile.Parse("go.mod", b, nil)
+	if err != nil {
+		klog.Fatalf("could not parse go.mod: %v", err)
+	}
+	modules := k8sReleaseModules(mod)
+	if len(modules) == 0 {
+		klog.Fatalf("--k8s-matrix: go.mod doesn't require %s", apimachineryModule)
+	}
+
+	targets := []buildTarget{}
+	for _, t := range resolveTargets() {
+		if isApiserverTarget(t.Name) {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		klog.Fatalf("--k8s-matrix requires the %s target", apiserverTarget)
+	}
+
+	failed := []string{}
+	for _, v := range k8sMatrix {
+		if err := buildK8sVersion(v, modules, targets); err != nil {
+			klog.Errorf("%s %s: %v", apimachineryModule, v, err)
+			failed = append(failed, v)
+			continue
+		}
+		klog.Infof("%s %s: ok", apimachineryModule, v)
+	}
+	if len(failed) > 0 {
+		klog.Fatalf("--k8s-matrix: the apiserver failed to compile against %s %s", apimachineryModule, strings.Join(failed, ", "))
+	}
+}
+
+// k8sReleaseModules returns the k8s.io modules go.mod requires at the version of k8s.io/apimachinery
+func k8sReleaseModules(mod *modfile.File) []string {
+	version := ""
+	for _, r := range mod.Require {
+		if r.Mod.Path == apimachineryModule {
+			version = r.Mod.Version
+		}
+	}
+	if len(version) == 0 {
+		return nil
+	}
+	modules := []string{}
+	for _, r := range mod.Require {
+		if strings.HasPrefix(r.Mod.Path, "k8s.io/") && r.Mod.Version == version {
+			modules = append(modules, r.Mod.Path)
+		}
+	}
+	return modules
+}
+
+// buildK8sVersion builds targets with modules replaced by version, using a go.mod copy
+// and a module cache in a temporary directory
+func buildK8sVersion(version string, modules []string, targets []buildTarget) error {
+	dir, err := tempDir("", "apiserver-boot-k8s-"+version+"-")
+	if err != nil {
+		return err
+	}
+	defer removeTempDir(dir)
+	modFile := filepath.Join(dir, "go.mod")
+	if err := copyFile("go.mod", modFile); err != nil {
+		return err
+	}
+	if _, err := os.Stat("go.sum"); err == nil {
+		if err := copyFile("go.sum", filepath.Join(dir, "go.sum")); err != nil {
+			return err
+		}
+	}
+
+	env := append(os.Environ(), userEnv()...)
+	env = append(env, "GOMODCACHE="+filepath.Join(dir, "mod"), "GOWORK=off")
+	// the module cache is read only, so remove it with go clean
+	defer func() {
+		if keepTemp {
+			return
+		}
+		c := exec.Command(goBinary(), "clean", "-modcache")
+		c.Env = env
+		if out, err := c.CombinedOutput(); err != nil {
+			klog.Warningf("could not remove the module cache in %s: %v\n%s", dir, err, out)
+		}
+	}()
+
+	edit := []string{"mod", "edit", "-modfile=" + modFile}
+	for _, m := range modules {
+		edit = append(edit, fmt.Sprintf("-replace=%s=%s@%s", m, m, version))
+	}
+	if err := runMatrixCommand(exec.Command(goBinary(), edit...), env); err != nil {
+		return err
+	}
+	for _, t := range targets {
+		output := filepath.Join(dir, binaryName(t.Binary))
+		c := exec.Command(goBinary(), "build", "-modfile="+modFile, "-mod=mod", "-o", output, "./"+filepath.ToSlash(t.Dir))
+		if err := runMatrixCommand(c, append(env, targetEnv(t, nil)...)); err != nil {
+			return fmt.Errorf("target %s failed: %v", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// runMatrixCommand runs c with the environment env
+func runMatrixCommand(c *exec.Cmd, env []string) error {
+	c.Env = env
+	c.Stderr = util.Stderr
+	c.Stdout = util.Stdout
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	return c.Run()
+}
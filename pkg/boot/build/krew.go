@@ -0,0 +1,211 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+var krewManifest string
+var krewPluginName string
+var krewURITemplate string
+var krewShortDescription string
+var krewHomepage string
+
+// krewName matches the names krew accepts for plugins
+var krewName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// krewVersion matches the semantic versions krew accepts for plugins
+var krewVersion = regexp.MustCompile(`^v\d+\.\d+\.\d+`)
+
+type krewPlugin struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   krewMetadata   `json:"metadata"`
+	Spec       krewPluginSpec `json:"spec"`
+}
+
+type krewMetadata struct {
+	Name string `json:"name"`
+}
+
+type krewPluginSpec struct {
+	Version          string         `json:"version"`
+	Homepage         string         `json:"homepage,omitempty"`
+	ShortDescription string         `json:"shortDescription"`
+	Platforms        []krewPlatform `json:"platforms"`
+}
+
+type krewPlatform struct {
+	Selector krewSelector `json:"selector"`
+	URI      string       `json:"uri"`
+	SHA256   string       `json:"sha256"`
+	Bin      string       `json:"bin"`
+}
+
+type krewSelector struct {
+	MatchLabels map[string]string `json:"matchLabels"`
+}
+
+// krewURIArgs are the variables of --krew-uri-template
+type krewURIArgs struct {
+	Version string
+	OS      string
+	Arch    string
+	Archive string
+}
+
+// checkKrewFlags exits if the --krew-manifest of the kubectl-plugin target can't be written
+func checkKrewFlags() {
+	if !selected(kubectlPlugin) {
+		klog.Fatalf("--krew-manifest requires the %s target built from cmd/kubectl-plugin", kubectlPlugin)
+	}
+	if !krewName.MatchString(krewPluginName) {
+		klog.Fatalf("--krew-manifest requires a --krew-plugin-name of lowercase letters, digits and dashes, got %q", krewPluginName)
+	}
+	if len(krewURITemplate) == 0 {
+		klog.Fatalf("--krew-manifest requires a --krew-uri-template the archives are downloaded from")
+	}
+	if _, err := template.New("krew-uri-template").Option("missingkey=error").Parse(krewURITemplate); err != nil {
+		klog.Fatalf("invalid --krew-uri-template %q: %v", krewURITemplate, err)
+	}
+	if len(krewShortDescription) == 0 {
+		klog.Warningf("the krew index requires a --krew-short-description of the plugin")
+	}
+}
+
+// writeKrewManifest archives the kubectl-plugin binary of each platform next to it, and writes
+// the krew plugin manifest installing them to --krew-manifest
+func writeKrewManifest() {
+	version := projectVersion()
+	if !krewVersion.MatchString(version) {
+		klog.Warningf("krew requires a semantic version like v1.2.3 for the plugin, got %q", version)
+	}
+	plugin := krewPlugin{
+		APIVersion: "krew.googlecontainertools.github.com/v1alpha2",
+		Kind:       "Plugin",
+		Metadata:   krewMetadata{Name: krewPluginName},
+		Spec: krewPluginSpec{
+			Version:          version,
+			Homepage:         krewHomepage,
+			ShortDescription: krewShortDescription,
+			Platforms:        []krewPlatform{},
+		},
+	}
+	uri := template.Must(template.New("krew-uri-template").Option("missingkey=error").Parse(krewURITemplate))
+	for _, a := range artifacts {
+		if a.Target != kubectlPlugin {
+			continue
+		}
+		bin := filepath.Base(a.Path)
+		if a.OS == "windows" && !strings.HasSuffix(bin, ".exe") {
+			// krew only runs windows plugins with the .exe extension
+			bin += ".exe"
+		}
+		archive := filepath.Join(filepath.Dir(a.Path), kubectlPlugin+"_"+a.OS+"_"+a.Arch+".tar.gz")
+		if err := writeKrewArchive(archive, a.Path, bin); err != nil {
+			klog.Fatal(err)
+		}
+		digest, err := fileDigest(archive)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		b := &bytes.Buffer{}
+		if err := uri.Execute(b, krewURIArgs{Version: version, OS: a.OS, Arch: a.Arch, Archive: filepath.Base(archive)}); err != nil {
+			klog.Fatalf("invalid --krew-uri-template %q: %v", krewURITemplate, err)
+		}
+		klog.Infof("Wrote %s for %s", displayPath(archive), b.String())
+		plugin.Spec.Platforms = append(plugin.Spec.Platforms, krewPlatform{
+			Selector: krewSelector{MatchLabels: map[string]string{"os": a.OS, "arch": a.Arch}},
+			URI:      b.String(),
+			SHA256:   digest,
+			Bin:      bin,
+		})
+	}
+
+	b, err := yaml.Marshal(plugin)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if err := ioutil.WriteFile(krewManifest, b, 0644); err != nil {
+		klog.Fatalf("could not write --krew-manifest %s: %v", krewManifest, err)
+	}
+	klog.Infof("Wrote the krew plugin manifest %s", displayPath(krewManifest))
+}
+
+// writeKrewArchive writes a tar.gz archive of the binary named bin, and of the LICENSE of the
+// project which the krew index requires if it exists, to archive
+func writeKrewArchive(archive, binary, bin string) error {
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	files := map[string]string{bin: binary}
+	if _, err := os.Stat("LICENSE"); err == nil {
+		files["LICENSE"] = "LICENSE"
+	}
+	for name, path := range files {
+		if err := addToArchive(tw, name, path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// addToArchive adds the file at path to the root of tw as name
+func addToArchive(tw *tar.Writer, name, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	h, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	if err := tw.WriteHeader(h); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, in)
+	return err
+}
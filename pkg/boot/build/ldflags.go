@@ -0,0 +1,222 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+var ldflagsFile string
+var versionPackage string
+var etcdPrefix string
+var etcdPrefixPackage string
+
+// linkerFlags returns the -ldflags for go build of target t: -s -w with --strip, the -X flags of --version-package,
+// of --etcd-prefix and --feature-gates for the apiservers and of --leader-election for the controller, a -X for each line of --ldflags-file followed by --ldflags,
+// so an explicit -X in --ldflags wins for the same variable.
+func linkerFlags(t buildTarget) string {
+	flags := []string{}
+	if strip {
+		flags = append(flags, "-s", "-w")
+	}
+	for _, v := range versionVars() {
+		flags = append(flags, "-X", v)
+	}
+	if isApiserverTarget(t.Name) && len(etcdPrefix) > 0 {
+		flags = append(flags, "-X", etcdPrefixPackage+".etcdPrefix="+etcdPrefix)
+	}
+	if isApiserverTarget(t.Name) && len(defaultFeatureGates) > 0 {
+		flags = append(flags, "-X", featureGatesPkg()+".defaultFeatureGates="+defaultFeatureGates)
+	}
+	if t.Name == controllerTarget {
+		for _, v := range leaderElectionFlags() {
+			flags = append(flags, "-X", v)
+		}
+		for _, v := range bindAddressFlags() {
+			flags = append(flags, "-X", v)
+		}
+	}
+	if len(ldflagsFile) > 0 {
+		vars, err := readLdflagsFile(ldflagsFile)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		for _, v := range vars {
+			if strings.ContainsAny(v, " \t") {
+				v = "'" + v + "'"
+			}
+			flags = append(flags, "-X", v)
+		}
+	}
+	if len(ldflags) > 0 {
+		// only --ldflags is a template, the values of --ldflags-file are passed as they are
+		flags = append(flags, renderTemplate("ldflags", ldflags, t.Binary))
+	}
+	return strings.Join(flags, " ")
+}
+
+// readLdflagsFile parses a file of import/path.Var=value lines.  Blank lines and
+// lines starting with # are ignored.
+func readLdflagsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read ldflags file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	vars := []string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		name := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || !strings.Contains(name, ".") || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected import/path.Var=value, got %q", path, n, line)
+		}
+		if strings.Contains(kv[1], "'") {
+			return nil, fmt.Errorf("%s:%d: values can't contain a single quote", path, n)
+		}
+		vars = append(vars, name+"="+strings.TrimSpace(kv[1]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read ldflags file %s: %v", path, err)
+	}
+	return vars, nil
+}
+
+// versionVars returns the import/path.Var=value assignments to the gitVersion, gitCommit and
+// buildDate variables of --version-package, named like the ones of k8s.io/component-base/version
+func versionVars() []string {
+	if len(versionPackage) == 0 {
+		return nil
+	}
+	vars := []string{
+		versionPackage + ".gitVersion=" + projectVersion(),
+		versionPackage + ".buildDate=" + buildStart.UTC().Format(time.RFC3339),
+	}
+	if out, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+		vars = append(vars, versionPackage+".gitCommit="+strings.TrimSpace(string(out)))
+	}
+	return vars
+}
+
+// checkVersionPackage exits if --version-package isn't a package the targets can import
+func checkVersionPackage() {
+	c := exec.Command(goBinary(), "list", "-f", "{{ .Name }}", versionPackage)
+	c.Env = append(os.Environ(), userEnv()...)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		klog.Fatalf("--version-package %s is not importable: %s", versionPackage, strings.TrimSpace(string(out)))
+	}
+	if name := strings.TrimSpace(string(out)); name == "main" {
+		klog.Fatalf("--version-package %s is a main package, use main.<var> in --ldflags instead", versionPackage)
+	}
+}
+
+// checkLinkerVars exits if a variable of the import/path.Var=value vars set by flag isn't
+// declared as a string variable of its package, main being the package of target t, since the
+// linker silently ignores -X into variables which don't exist
+func checkLinkerVars(flag string, t buildTarget, vars []string) {
+	for _, v := range vars {
+		ref := strings.SplitN(v, "=", 2)[0]
+		i := strings.LastIndex(ref, ".")
+		pkg, name := ref[:i], ref[i+1:]
+		dir := t.Dir
+		if pkg != "main" {
+			c := exec.Command(goBinary(), "list", "-f", "{{ .Dir }}", pkg)
+			c.Env = append(os.Environ(), userEnv()...)
+			out, err := c.CombinedOutput()
+			if err != nil {
+				klog.Fatalf("%s sets %s, but %s is not importable: %s", flag, ref, pkg, strings.TrimSpace(string(out)))
+			}
+			dir = strings.TrimSpace(string(out))
+		}
+		if !declaresStringVar(dir, name) {
+			klog.Fatalf("%s sets %s, but %s doesn't declare it, add `var %s string` to it", flag, ref, dir, name)
+		}
+	}
+}
+
+// declaresStringVar returns true if the go files in dir declare name as a package level
+// variable -X can set, i.e. a string which is unset or initialized to a string literal
+func declaresStringVar(dir, name string) bool {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	fset := token.NewFileSet()
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, f, nil, 0)
+		if err != nil {
+			klog.Fatalf("could not parse %s: %v", f, err)
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, n := range vs.Names {
+					if n.Name != name {
+						continue
+					}
+					if typ, ok := vs.Type.(*ast.Ident); ok {
+						return typ.Name == "string"
+					}
+					if vs.Type == nil && len(vs.Values) > i {
+						lit, ok := vs.Values[i].(*ast.BasicLit)
+						return ok && lit.Kind == token.STRING
+					}
+					return false
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkEtcdPrefix exits if --etcd-prefix isn't a clean absolute path, or the apiserver targets
+// don't declare the variable it sets
+func checkEtcdPrefix() {
+	if !strings.HasPrefix(etcdPrefix, "/") || path.Clean(etcdPrefix) != etcdPrefix || strings.ContainsAny(etcdPrefix, " \t'") {
+		klog.Fatalf("--etcd-prefix must be a clean absolute path without spaces or quotes, e.g. /registry/example.com, got %q", etcdPrefix)
+	}
+	for _, t := range resolveTargets() {
+		if isApiserverTarget(t.Name) {
+			checkLinkerVars("--etcd-prefix", t, []string{etcdPrefixPackage + ".etcdPrefix=" + etcdPrefix})
+		}
+	}
+	if !buildApiserver() && len(targetGroups()) == 0 {
+		klog.Warningf("--etcd-prefix has no effect without an %s target", apiserverTarget)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkerFlagsTemplates(t *testing.T) {
+	defer func(file, flags, version string) { ldflagsFile, ldflags, sourceVersion = file, flags, version }(ldflagsFile, ldflags, sourceVersion)
+	sourceVersion = "v1.0.0"
+
+	ldflagsFile = filepath.Join(t.TempDir(), "ldflags")
+	content := "example.com/app/pkg/motd.banner={{ shown as is }}\n"
+	if err := ioutil.WriteFile(ldflagsFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ldflags = "-X main.name={{.Target}}"
+
+	want := "-X 'example.com/app/pkg/motd.banner={{ shown as is }}' -X main.name=apiserver"
+	if got := linkerFlags(buildTarget{Name: apiserverTarget, Binary: "apiserver"}); got != want {
+		t.Errorf("linkerFlags() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+var leaderElection []string
+var leaderElectionPackage string
+
+// leaderElectionVars are the variables of --leader-election-package set by the --leader-election
+// settings, named like the controller-runtime manager options they default
+var leaderElectionVars = map[string]string{
+	"lease-duration": "leaseDuration",
+	"renew-deadline": "renewDeadline",
+	"retry-period":   "retryPeriod",
+}
+
+// leaderElectionDefaults are the controller-runtime manager defaults of the --leader-election
+// settings, which the binary runs with for the settings which aren't set
+var leaderElectionDefaults = map[string]time.Duration{
+	"lease-duration": 15 * time.Second,
+	"renew-deadline": 10 * time.Second,
+	"retry-period":   2 * time.Second,
+}
+
+// leaderElectionFlags returns the import/path.Var=value assignments of the --leader-election
+// settings, exiting if they aren't durations leader election can run with
+func leaderElectionFlags() []string {
+	if len(leaderElection) == 0 {
+		return nil
+	}
+	durations := map[string]time.Duration{}
+	vars := []string{}
+	for _, s := range leaderElection {
+		kv := strings.SplitN(s, "=", 2)
+		name, found := leaderElectionVars[kv[0]]
+		if len(kv) != 2 || !found {
+			klog.Fatalf("--leader-election %q must be one of lease-duration, renew-deadline or retry-period=<duration>", s)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil || d <= 0 {
+			klog.Fatalf("--leader-election %s must be a positive duration, got %q", kv[0], kv[1])
+		}
+		durations[kv[0]] = d
+		vars = append(vars, leaderElectionPackage+"."+name+"="+d.String())
+	}
+	for k, d := range leaderElectionDefaults {
+		if _, found := durations[k]; !found {
+			durations[k] = d
+		}
+	}
+	// the durations client-go leader election checks, against the defaults of the settings which aren't set
+	lease, renew, retry := durations["lease-duration"], durations["renew-deadline"], durations["retry-period"]
+	if lease <= renew {
+		klog.Fatalf("--leader-election lease-duration %v must be greater than renew-deadline %v", lease, renew)
+	}
+	if renew <= time.Duration(1.2*float64(retry)) {
+		klog.Fatalf("--leader-election renew-deadline %v must be greater than 1.2 times retry-period %v", renew, retry)
+	}
+	sort.Strings(vars)
+	return vars
+}
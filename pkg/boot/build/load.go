@@ -0,0 +1,83 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os/exec"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var loadInto string
+
+// loadTarget returns the tool and cluster of --load-into, kind[:<cluster>] or minikube[:<profile>]
+func loadTarget() (string, string) {
+	parts := strings.SplitN(loadInto, ":", 2)
+	tool, cluster := parts[0], ""
+	if len(parts) == 2 {
+		cluster = parts[1]
+	}
+	switch {
+	case tool == "kind" && len(cluster) == 0:
+		cluster = "kind"
+	case tool == "minikube" && len(cluster) == 0:
+		cluster = "minikube"
+	case (tool != "kind" && tool != "minikube") || strings.ContainsAny(cluster, " \t"):
+		klog.Fatalf("--load-into must be kind[:<cluster>] or minikube[:<profile>], got %q", loadInto)
+	}
+	return tool, cluster
+}
+
+// checkLoadTarget exits if the tool of --load-into isn't installed or its cluster doesn't exist
+func checkLoadTarget() {
+	tool, cluster := loadTarget()
+	if _, err := exec.LookPath(tool); err != nil {
+		klog.Fatalf("--load-into %s requires the %s CLI in the PATH", loadInto, tool)
+	}
+	switch tool {
+	case "kind":
+		out, err := exec.Command("kind", "get", "clusters").Output()
+		if err != nil {
+			klog.Fatalf("could not list the kind clusters: %v", err)
+		}
+		clusters := strings.Fields(string(out))
+		for _, c := range clusters {
+			if c == cluster {
+				return
+			}
+		}
+		klog.Fatalf("--load-into: there is no kind cluster %s, the clusters are %q.  Create it with kind create cluster --name %s", cluster, clusters, cluster)
+	case "minikube":
+		if err := exec.Command("minikube", "status", "--profile", cluster).Run(); err != nil {
+			klog.Fatalf("--load-into: the minikube cluster %s isn't running, start it with minikube start --profile %s", cluster, cluster)
+		}
+	}
+}
+
+// loadImage loads image from the docker daemon into the --load-into cluster
+func loadImage(image string) {
+	tool, cluster := loadTarget()
+	klog.Infof("Loading %s into the %s cluster %s", image, tool, cluster)
+	switch tool {
+	case "kind":
+		util.DoCmd("kind", "load", "docker-image", image, "--name", cluster)
+	case "minikube":
+		util.DoCmd("minikube", "image", "load", image, "--profile", cluster)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+var noLock bool
+var lockTimeout time.Duration
+
+// lockFileName is the lock file created in the output directory
+const lockFileName = ".apiserver-boot.lock"
+
+// lockOutput blocks until this is the only invocation changing the binaries in dir, and
+// returns a func to let other invocations continue.  The lock is released by the OS if
+// the invocation exits without calling it, so a left over lock file never blocks another
+// invocation, it is only reported as stale.
+func lockOutput(dir string) func() {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		klog.Fatalf("could not create %s: %v", dir, err)
+	}
+	path := filepath.Join(dir, lockFileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		klog.Fatalf("could not lock %s: %v", dir, err)
+	}
+
+	start := time.Now()
+	waiting := false
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			klog.Fatalf("could not lock %s: %v", dir, err)
+		}
+		if locked {
+			break
+		}
+		holder := lockHolder(path)
+		if lockTimeout > 0 && time.Since(start) > lockTimeout {
+			klog.Fatalf("timed out after --lock-timeout %v waiting for %s held by %s", lockTimeout, path, holder)
+		}
+		if !waiting {
+			klog.Infof("Waiting for %s held by %s", path, holder)
+			waiting = true
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if holder := lockHolder(path); len(holder) > 0 {
+		klog.Infof("Taking over the stale lock %s left by %s", path, holder)
+	}
+	host, _ := os.Hostname()
+	if err := f.Truncate(0); err == nil {
+		fmt.Fprintf(f, "pid %d on %s\n", os.Getpid(), host)
+	}
+	return func() {
+		f.Truncate(0)
+		unlockFile(f)
+		f.Close()
+	}
+}
+
+// lockHolder returns the invocation recorded in the lock file at path, or "" if there is none
+func lockHolder(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
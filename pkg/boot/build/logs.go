@@ -0,0 +1,108 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var logFile string
+var logAppend bool
+
+var fatalHooks []func()
+var fatalHooksLock sync.Mutex
+var fatalOnce sync.Once
+var setupLogsOnce sync.Once
+
+// SetupLogs configures klog for the commands building the project: each message is written once,
+// to stderr and to --log-file when teeLogs opens it, and the onFatal functions run before
+// klog.Fatal exits.  It is the PersistentPreRun of the build and run commands rather than run at
+// init, so importing the package leaves the klog configuration of the process alone.
+func SetupLogs(cmd *cobra.Command, args []string) {
+	setupLogsOnce.Do(func() {
+		logOutput(ioutil.Discard)
+		// klog.Fatal skips the deferred removeTempDir calls
+		onFatal(removeTempDirs)
+	})
+}
+
+// onFatal registers fn to run when klog.Fatal exits, which skips the deferred calls.  klog
+// holds its lock while fn runs, so fn must not log.
+func onFatal(fn func()) {
+	fatalHooksLock.Lock()
+	defer fatalHooksLock.Unlock()
+	fatalHooks = append(fatalHooks, fn)
+}
+
+// fatalWriter runs the onFatal functions before writing the FATAL messages of klog
+type fatalWriter struct {
+	io.Writer
+}
+
+func (w fatalWriter) Write(b []byte) (int, error) {
+	fatalOnce.Do(func() {
+		fatalHooksLock.Lock()
+		defer fatalHooksLock.Unlock()
+		for _, fn := range fatalHooks {
+			fn()
+		}
+	})
+	return w.Writer.Write(b)
+}
+
+// logOutput writes each log message once to w, running the onFatal functions for the
+// FATAL messages, and also to stderr as before
+func logOutput(w io.Writer) {
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	for name, value := range map[string]string{"logtostderr": "false", "alsologtostderr": "true", "one_output": "true"} {
+		if err := fs.Set(name, value); err != nil {
+			klog.Fatal(err)
+		}
+	}
+	klog.SetOutput(w)
+	klog.SetOutputBySeverity("FATAL", fatalWriter{w})
+}
+
+// teeLogs writes the log messages and the output of the commands run for the build to
+// --log-file as well as to the console
+func teeLogs() {
+	if len(logFile) == 0 {
+		return
+	}
+	mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if logAppend {
+		mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(logFile, mode, 0644)
+	if err != nil {
+		klog.Fatalf("could not open --log-file %s: %v", logFile, err)
+	}
+
+	logOutput(f)
+
+	util.Stdout = io.MultiWriter(os.Stdout, f)
+	util.Stderr = io.MultiWriter(os.Stderr, f)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+var manifestFile string
+var manifestFormat string
+
+// buildStart is when the current build started
+var buildStart = time.Now()
+
+// buildManifest is the --manifest record of the artifacts of an invocation
+type buildManifest struct {
+	Version   string             `json:"version"`
+	BuildTime string             `json:"buildTime"`
+	Flags     []string           `json:"flags"`
+	Artifacts []manifestArtifact `json:"artifacts"`
+}
+
+type manifestArtifact struct {
+	Target string `json:"target"`
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeManifest writes the artifacts of all the platforms built with the flags set on cmd to --manifest
+func writeManifest(cmd *cobra.Command) {
+	m := buildManifest{
+		Version:   projectVersion(),
+		BuildTime: buildStart.UTC().Format(time.RFC3339),
+		Flags:     passedFlags(cmd, nil),
+		Artifacts: []manifestArtifact{},
+	}
+	for _, a := range artifacts {
+		info, err := os.Stat(a.Path)
+		if err != nil {
+			klog.Fatalf("could not stat %s: %v", a.Path, err)
+		}
+		digest, err := fileDigest(a.Path)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		m.Artifacts = append(m.Artifacts, manifestArtifact{
+			Target: a.Target,
+			OS:     a.OS,
+			Arch:   a.Arch,
+			Path:   displayPath(a.Path),
+			Size:   info.Size(),
+			SHA256: digest,
+		})
+	}
+
+	b, err := yaml.Marshal(m)
+	if manifestFormat == "json" {
+		b, err = json.MarshalIndent(m, "", "  ")
+		b = append(b, '\n')
+	}
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if err := ioutil.WriteFile(manifestFile, b, 0644); err != nil {
+		klog.Fatalf("could not write --manifest %s: %v", manifestFile, err)
+	}
+}
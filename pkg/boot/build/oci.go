@@ -0,0 +1,213 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+var ociLayout string
+var ociBaseImage string
+
+// buildOCILayout builds the binaries for each of the platforms and writes an image index
+// with an image per platform to the OCI layout directory, without a docker daemon
+func buildOCILayout(cmd *cobra.Command, args []string) {
+	if debugImage {
+		klog.Fatalf("--debug-image is not supported with --oci-layout")
+	}
+	if len(baseImageDigest) > 0 {
+		ociBaseImage = pinnedBaseImage()
+	}
+	base, err := name.ParseReference(ociBaseImage)
+	if err != nil {
+		klog.Fatalf("invalid --oci-base-image %q: %v", ociBaseImage, err)
+	}
+
+	dir, err := tempDir(os.TempDir(), "apiserver-boot-build-container")
+	if err != nil {
+		klog.Fatalf("failed to create temp directory %s %v", dir, err)
+	}
+	defer removeTempDir(dir)
+
+	if len(platforms) == 0 {
+		platforms = []string{"linux/amd64"}
+	}
+	outputdir = dir
+	// the image contains the binaries by their default names
+	nameTemplate = ""
+	outputTemplate = ""
+	RunBuildExecutables(cmd, args)
+
+	labels := containerLabels()
+	var index v1.ImageIndex = empty.Index
+	for _, p := range buildPlatforms() {
+		klog.Infof("Adding the binaries for %s/%s to %s", p.OS, p.Arch, ociBaseImage)
+		img, err := remote.Image(base,
+			remote.WithAuthFromKeychain(authn.DefaultKeychain),
+			remote.WithPlatform(v1.Platform{OS: p.OS, Architecture: p.Arch}))
+		if err != nil {
+			klog.Fatalf("could not fetch %s for %s/%s: %v", ociBaseImage, p.OS, p.Arch, err)
+		}
+		layers, err := binariesLayers(p)
+		if err != nil {
+			klog.Fatalf("could not create the layer for %s/%s: %v", p.OS, p.Arch, err)
+		}
+		img, err = mutate.AppendLayers(img, layers...)
+		if err != nil {
+			klog.Fatalf("could not add the binaries to %s: %v", ociBaseImage, err)
+		}
+		img, err = labelImage(img, labels)
+		if err != nil {
+			klog.Fatalf("could not label the image for %s/%s: %v", p.OS, p.Arch, err)
+		}
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{OS: p.OS, Architecture: p.Arch},
+			},
+		})
+	}
+
+	klog.Infof("Writing the OCI layout to %s", ociLayout)
+	l, err := layout.Write(ociLayout, empty.Index)
+	if err != nil {
+		klog.Fatalf("could not write the OCI layout %s: %v", ociLayout, err)
+	}
+	err = l.AppendIndex(index, layout.WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": Image,
+	}))
+	if err != nil {
+		klog.Fatalf("could not write the image index to %s: %v", ociLayout, err)
+	}
+}
+
+// labelImage returns img with labels added to the labels of its config
+func labelImage(img v1.Image, labels map[string]string) (v1.Image, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	config := cfg.Config.DeepCopy()
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		config.Labels[k] = v
+	}
+	return mutate.Config(img, *config)
+}
+
+// binariesLayers returns a layer with the binaries built for p in the root directory,
+// like the ADDs in the Dockerfile, or with --layered a layer for each binary
+func binariesLayers(p platform) ([]v1.Layer, error) {
+	paths := []string{}
+	for _, a := range artifacts {
+		if a.OS == p.OS && a.Arch == p.Arch {
+			paths = append(paths, a.Path)
+		}
+	}
+	if !layered {
+		l, err := binariesLayer(paths)
+		return []v1.Layer{l}, err
+	}
+	layers := []v1.Layer{}
+	for _, path := range paths {
+		l, err := binariesLayer([]string{path})
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// binariesLayer returns a layer with the binaries at paths in the root directory
+func binariesLayer(paths []string) (v1.Layer, error) {
+	buf := &bytes.Buffer{}
+	w := tar.NewWriter(buf)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		err = w.WriteHeader(&tar.Header{
+			Name:     filepath.Base(path),
+			Mode:     0755,
+			Size:     info.Size(),
+			Typeflag: tar.TypeReg,
+		})
+		if err == nil {
+			_, err = io.Copy(w, f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	return tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+}
+
+// pinnedBaseImage returns --base-image-digest, resolving it to the current digest of the
+// tag if it isn't referenced by digest
+func pinnedBaseImage() string {
+	ref, err := name.ParseReference(baseImageDigest)
+	if err != nil {
+		klog.Fatalf("invalid --base-image-digest %q: %v", baseImageDigest, err)
+	}
+	if d, ok := ref.(name.Digest); ok {
+		if !strings.HasPrefix(d.DigestStr(), "sha256:") {
+			klog.Fatalf("--base-image-digest %q must be pinned by a sha256 digest", baseImageDigest)
+		}
+		return baseImageDigest
+	}
+	desc, err := remote.Head(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		klog.Fatalf("could not resolve the digest of --base-image-digest %s: %v", baseImageDigest, err)
+	}
+	pinned := ref.Context().Digest(desc.Digest.String()).String()
+	klog.Warningf("--base-image-digest %s is a tag, building from its current digest %s.  "+
+		"Pass the digest to build the same image later.", baseImageDigest, pinned)
+	return pinned
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var offline bool
+
+// offlineConflicts are the flags of build executables which need network access, why they
+// can't be used with --offline
+var offlineConflicts = map[string]string{
+	"bazel":         "bazel fetches the external repositories",
+	"in-container":  "docker may pull the --builder-image",
+	"otel-endpoint": "the trace is exported to the collector",
+	"vulncheck":     "govulncheck fetches the vulnerability database",
+	"goproxy":       "it selects a module proxy",
+}
+
+// offlineEnv returns the environment making the go commands fail instead of downloading
+// modules, checksums or toolchains
+func offlineEnv() []string {
+	env := []string{"GOPROXY=off", "GOSUMDB=off", "GOTOOLCHAIN=local"}
+	if len(modMode) == 0 {
+		env = append([]string{"GOFLAGS=" + mergeGoflags(os.Getenv("GOFLAGS"), "-mod=mod")}, env...)
+	}
+	return env
+}
+
+// checkOfflineFlags exits if a flag needing network access is set with --offline
+func checkOfflineFlags(cmd *cobra.Command) {
+	for name, reason := range offlineConflicts {
+		if cmd.Flags().Changed(name) {
+			klog.Fatalf("--%s can't be used with --offline, %s", name, reason)
+		}
+	}
+	if modMode != "vendor" {
+		klog.Infof("--offline builds with the modules of the module cache, build with --mod vendor too to only use the vendor directory")
+	}
+}
+
+// checkOfflineModules exits listing the packages of the targets which can't be loaded without
+// downloading a module missing from the module cache
+func checkOfflineModules() {
+	args := append([]string{"list", "-e", "-deps", "-f", "{{ with .Error }}{{ $.ImportPath }}: {{ .Err }}{{ end }}"}, runtimeReplaceArgs()...)
+	c := exec.Command(goBinary(), append(args, vulncheckPackages()...)...)
+	c.Env = append(os.Environ(), userEnv()...)
+	if len(runtimeModFile) > 0 {
+		c.Env = append(c.Env, "GOWORK=off")
+	}
+	c.Stderr = util.Stderr
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	out, err := c.Output()
+	missing := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if len(line) > 0 {
+			missing = append(missing, line)
+		}
+	}
+	if err != nil {
+		missing = append(missing, err.Error())
+	}
+	if len(missing) > 0 {
+		klog.Fatalf("--offline: the targets need modules missing from the module cache, download them with network access first "+
+			"with `go mod download`, or vendor them and build with --mod vendor:\n  %s", strings.Join(missing, "\n  "))
+	}
+}
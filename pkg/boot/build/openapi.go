@@ -0,0 +1,325 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var verifyOpenAPI bool
+
+// openAPICheckFile is the file of the --validate-openapi mode in the apiserver target directories
+const openAPICheckFile = "zz_generated.openapi_check.go"
+
+// verifyOpenAPITimeout bounds how long a built apiserver may run for --verify-openapi
+const verifyOpenAPITimeout = 2 * time.Minute
+
+// generateOpenAPICheck writes the --validate-openapi mode into the directory of each apiserver target
+func generateOpenAPICheck() {
+	for _, t := range resolveTargets() {
+		if !isApiserverTarget(t.Name) {
+			continue
+		}
+		generated := filepath.Join(t.Dir, openAPICheckFile)
+		klog.Infof("Writing the --validate-openapi mode of %s to %s", t.Name, generated)
+		util.Overwrite(generated, "openapi-check-template", openAPICheckTemplate, nil)
+		recordGenerated(generated)
+	}
+}
+
+// runOpenAPIChecks runs the built apiservers with --validate-openapi, failing if the OpenAPI
+// documents they serve don't load.  The apiservers print the schemas which don't.
+func runOpenAPIChecks() {
+	for _, a := range artifacts {
+		if !isApiserverTarget(a.Target) {
+			continue
+		}
+		if a.OS != runtime.GOOS || a.Arch != runtime.GOARCH {
+			klog.Warningf("Skipping --verify-openapi of %s, binaries built for %s/%s can't run on %s/%s",
+				a.Path, a.OS, a.Arch, runtime.GOOS, runtime.GOARCH)
+			continue
+		}
+		bin, err := filepath.Abs(a.Path)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		port, err := freePort()
+		if err != nil {
+			klog.Fatalf("--verify-openapi: could not find a free port for %s: %v", a.Path, err)
+		}
+		certs, err := tempDir("", "apiserver-boot-openapi-")
+		if err != nil {
+			klog.Fatalf("could not create a directory for the serving certificates of %s: %v", a.Path, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), verifyOpenAPITimeout)
+		c := exec.CommandContext(ctx, bin, "--validate-openapi", "--bind-address=127.0.0.1",
+			fmt.Sprintf("--secure-port=%d", port), "--cert-dir="+certs)
+		klog.Infof("%s", strings.Join(c.Args, " "))
+		c.Stderr = util.Stderr
+		c.Stdout = util.Stdout
+		err = c.Run()
+		cancel()
+		removeTempDir(certs)
+		if ctx.Err() == context.DeadlineExceeded {
+			klog.Fatalf("--verify-openapi: %s did not exit within %v", a.Path, verifyOpenAPITimeout)
+		}
+		if err != nil {
+			klog.Fatalf("--verify-openapi: the OpenAPI documents served by %s don't load: %v", a.Path, err)
+		}
+	}
+}
+
+// freePort returns a port of 127.0.0.1 nothing is listening on
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+var openAPICheckTemplate = `// Code generated by apiserver-boot build executables --verify-openapi. DO NOT EDIT.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/generic"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder"
+)
+
+// validateOpenAPI runs the apiserver without etcd, checks the OpenAPI documents it serves load and exits
+var validateOpenAPI bool
+
+func init() {
+	builder.APIServer.
+		WithFlagFns(func(fs *pflag.FlagSet) *pflag.FlagSet {
+			fs.BoolVar(&validateOpenAPI, "validate-openapi", false, "if true, check the /openapi/v2 and /openapi/v3 documents "+
+				"served by the apiserver load, printing the schemas which don't, and exit.  Doesn't connect to etcd or a kube-apiserver.")
+			return fs
+		}).
+		WithOptionsFns(func(o *builder.ServerOptions) *builder.ServerOptions {
+			if !validateOpenAPI {
+				return o
+			}
+			o.RecommendedOptions.Authentication.RemoteKubeConfigFileOptional = true
+			o.RecommendedOptions.Authorization = nil
+			o.RecommendedOptions.CoreAPI = nil
+			o.RecommendedOptions.Admission = nil
+			if o.RecommendedOptions.Etcd != nil && len(o.RecommendedOptions.Etcd.StorageConfig.Transport.ServerList) == 0 {
+				// never connected to, passes the validation of the etcd flags
+				o.RecommendedOptions.Etcd.StorageConfig.Transport.ServerList = []string{"http://127.0.0.1:2379"}
+			}
+			// unknown to the apiservers serving /openapi/v3 without the gate
+			_ = utilfeature.DefaultMutableFeatureGate.Set("OpenAPIV3=true")
+			return o
+		}).
+		WithConfigFns(func(c *genericapiserver.RecommendedConfig) *genericapiserver.RecommendedConfig {
+			if validateOpenAPI && c.RESTOptionsGetter != nil {
+				c.RESTOptionsGetter = validateOnlyRESTOptions{c.RESTOptionsGetter}
+			}
+			return c
+		}).
+		WithPostStartHook("validate-openapi", func(ctx genericapiserver.PostStartHookContext) error {
+			if !validateOpenAPI {
+				return nil
+			}
+			if err := checkOpenAPI(ctx.LoopbackClientConfig); err != nil {
+				fmt.Fprintf(os.Stderr, "--validate-openapi: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(os.Stderr, "--validate-openapi: the OpenAPI documents load")
+			os.Exit(0)
+			return nil
+		})
+}
+
+// validateOnlyRESTOptions creates the storage of the resources without connecting to etcd.
+// The resources can't be served, only their OpenAPI schemas.
+type validateOnlyRESTOptions struct {
+	generic.RESTOptionsGetter
+}
+
+func (v validateOnlyRESTOptions) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
+	opts, err := v.RESTOptionsGetter.GetRESTOptions(resource)
+	opts.Decorator = withoutStorage
+	opts.CountMetricPollPeriod = 0
+	return opts, err
+}
+
+// withoutStorage is a generic.StorageDecorator returning no storage
+func withoutStorage(*storagebackend.ConfigForResource, string, func(runtime.Object) (string, error), func() runtime.Object,
+	func() runtime.Object, storage.AttrFunc, storage.IndexerFuncs, *cache.Indexers) (storage.Interface, factory.DestroyFunc, error) {
+	return nil, func() {}, nil
+}
+
+// checkOpenAPI gets the OpenAPI documents from the apiserver, and returns an error if they,
+// or the schemas they define, don't load
+func checkOpenAPI(config *rest.Config) error {
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: transport}
+	get := func(path string) ([]byte, int, error) {
+		resp, err := client.Get(config.Host + path)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return b, resp.StatusCode, err
+	}
+
+	b, code, err := get("/openapi/v2")
+	if err != nil {
+		return err
+	}
+	if code != http.StatusOK {
+		return fmt.Errorf("GET /openapi/v2 returned %d, are the OpenAPI definitions registered with WithOpenAPIDefinitions?", code)
+	}
+	v2 := struct {
+		Definitions map[string]json.RawMessage ` + "`json:\"definitions\"`" + `
+	}{}
+	if err := json.Unmarshal(b, &v2); err != nil {
+		return fmt.Errorf("/openapi/v2 does not load: %v", err)
+	}
+	failed := checkSchemas("/openapi/v2", v2.Definitions)
+
+	b, code, err = get("/openapi/v3")
+	if err != nil {
+		return err
+	}
+	if code == http.StatusNotFound {
+		fmt.Fprintln(os.Stderr, "--validate-openapi: /openapi/v3 is not served, skipping it")
+	} else if code != http.StatusOK {
+		return fmt.Errorf("GET /openapi/v3 returned %d: %s", code, b)
+	} else {
+		paths, err := openAPIV3Paths(b)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			b, code, err := get(p)
+			if err != nil {
+				return err
+			}
+			if code != http.StatusOK {
+				return fmt.Errorf("GET %s returned %d: %s", p, code, b)
+			}
+			v3 := struct {
+				Components struct {
+					Schemas map[string]json.RawMessage ` + "`json:\"schemas\"`" + `
+				} ` + "`json:\"components\"`" + `
+			}{}
+			if err := json.Unmarshal(b, &v3); err != nil {
+				return fmt.Errorf("%s does not load: %v", p, err)
+			}
+			failed += checkSchemas(p, v3.Components.Schemas)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d schemas do not load", failed)
+	}
+	return nil
+}
+
+// openAPIV3Paths returns the paths of the group version documents listed by the /openapi/v3
+// discovery document, a list of paths or a map of the paths to their serverRelativeURL
+func openAPIV3Paths(discovery []byte) ([]string, error) {
+	d := struct {
+		Paths json.RawMessage
+	}{}
+	if err := json.Unmarshal(discovery, &d); err != nil {
+		return nil, fmt.Errorf("/openapi/v3 does not load: %v", err)
+	}
+	paths := []string{}
+	list := []string{}
+	if err := json.Unmarshal(d.Paths, &list); err == nil {
+		for _, p := range list {
+			paths = append(paths, "/openapi/v3/"+p)
+		}
+		sort.Strings(paths)
+		return paths, nil
+	}
+	urls := map[string]struct {
+		ServerRelativeURL string ` + "`json:\"serverRelativeURL\"`" + `
+	}{}
+	if err := json.Unmarshal(d.Paths, &urls); err != nil {
+		return nil, fmt.Errorf("/openapi/v3 does not load: %v", err)
+	}
+	for p, u := range urls {
+		if len(u.ServerRelativeURL) == 0 {
+			u.ServerRelativeURL = "/openapi/v3/" + p
+		}
+		paths = append(paths, u.ServerRelativeURL)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// checkSchemas prints the schemas of the document at path which don't load, and returns how many
+func checkSchemas(path string, schemas map[string]json.RawMessage) int {
+	names := []string{}
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	failed := 0
+	for _, name := range names {
+		s := spec.Schema{}
+		err := json.Unmarshal(schemas[name], &s)
+		if err == nil {
+			_, err = json.Marshal(&s)
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "--validate-openapi: schema %s of %s does not load: %v\n%s\n", name, path, err, schemas[name])
+		}
+	}
+	return failed
+}
+`
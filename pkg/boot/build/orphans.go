@@ -0,0 +1,145 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var reportUnusedGenerated bool
+var pruneGenerated bool
+
+// generatedHeader starts the files apiserver-boot generates into the target directories
+const generatedHeader = "// Code generated by apiserver-boot build executables"
+
+// writtenGenerated are the files the code generation of this invocation wrote into the target
+// directories
+var writtenGenerated = map[string]bool{}
+
+// recordGenerated records that the code generation wrote path
+func recordGenerated(path string) {
+	writtenGenerated[filepath.Clean(path)] = true
+}
+
+// reportOrphans lists the generated files which the code generation no longer writes: the
+// files generated by apiserver-boot into the target directories for flags which aren't set
+// anymore, and the generated files left in the directories of pkg/apis without types.  With
+// --prune-generated they are removed after being listed.
+func reportOrphans() {
+	orphans := []string{}
+	seen := map[string]bool{}
+	for _, t := range resolveTargets() {
+		if seen[t.Dir] {
+			continue
+		}
+		seen[t.Dir] = true
+		files, _ := filepath.Glob(filepath.Join(t.Dir, "zz_generated.*.go"))
+		for _, f := range files {
+			if !writtenGenerated[filepath.Clean(f)] && generatedByBoot(f) {
+				orphans = append(orphans, f)
+			}
+		}
+	}
+	orphans = append(orphans, orphanedAPIFiles()...)
+	sort.Strings(orphans)
+
+	if len(orphans) == 0 {
+		klog.Infof("No orphaned generated files")
+		return
+	}
+	if !pruneGenerated {
+		klog.Warningf("Generated files which the code generation no longer writes, remove them with --prune-generated:\n  %s",
+			strings.Join(orphans, "\n  "))
+		return
+	}
+	klog.Infof("Removing the generated files which the code generation no longer writes:\n  %s", strings.Join(orphans, "\n  "))
+	for _, f := range orphans {
+		if err := os.Remove(f); err != nil {
+			klog.Fatalf("could not remove %s: %v", f, err)
+		}
+		// remove the directory of a removed API version once it's empty
+		os.Remove(filepath.Dir(f))
+	}
+}
+
+// removeUnwritten removes the file name apiserver-boot generates into the apiserver target
+// directories for --flag when this invocation didn't write it, e.g. because the flag isn't set
+// anymore, so it isn't compiled into the binaries of the builds without the flag
+func removeUnwritten(name, flag string) {
+	for _, t := range resolveTargets() {
+		f := filepath.Join(t.Dir, name)
+		if !isApiserverTarget(t.Name) || writtenGenerated[filepath.Clean(f)] || !generatedByBoot(f) {
+			continue
+		}
+		klog.Infof("Removing %s, --%s doesn't generate it for %s", f, flag, t.Name)
+		if err := os.Remove(f); err != nil {
+			klog.Fatalf("could not remove %s: %v", f, err)
+		}
+	}
+}
+
+// generatedByBoot returns true if the file at path starts with the generatedHeader
+func generatedByBoot(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	return strings.HasPrefix(line, generatedHeader)
+}
+
+// orphanedAPIFiles returns the generated files of the directories under pkg/apis which have
+// no other go files, e.g. left behind after the types of an API version were removed
+func orphanedAPIFiles() []string {
+	orphans := []string{}
+	filepath.Walk(filepath.Join("pkg", "apis"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil
+		}
+		generated := []string{}
+		for _, f := range files {
+			switch {
+			case f.IsDir():
+			case isGeneratedAPIFile(f.Name()):
+				generated = append(generated, filepath.Join(path, f.Name()))
+			case strings.HasSuffix(f.Name(), ".go"):
+				return nil
+			}
+		}
+		orphans = append(orphans, generated...)
+		return nil
+	})
+	return orphans
+}
+
+// isGeneratedAPIFile returns true for the names of the files generated into the API packages
+func isGeneratedAPIFile(name string) bool {
+	return strings.HasPrefix(name, "zz_generated.") && strings.HasSuffix(name, ".go") ||
+		name == "generated.pb.go" || name == "generated.proto"
+}
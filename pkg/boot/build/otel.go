@@ -0,0 +1,131 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+var otelEndpoint string
+var otelInsecure bool
+
+// traceCtx is the context of the root span of the build, the phases are its children
+var traceCtx = context.Background()
+
+// tracer creates the build spans.  It doesn't record them unless --otel-endpoint is set.
+func tracer() trace.Tracer {
+	return otel.Tracer("sigs.k8s.io/apiserver-builder-alpha/pkg/boot/build")
+}
+
+// tracingFatal is set while the trace is flushed for klog.Fatal, when klog can't be used
+var tracingFatal int32
+
+// otelErrorHandler logs the errors of the exporter instead of failing the build
+type otelErrorHandler struct{}
+
+func (otelErrorHandler) Handle(err error) {
+	if err == nil {
+		return
+	}
+	warnExport(err)
+}
+
+// warnExport warns the trace couldn't be exported, without klog while it's exiting
+func warnExport(err error) {
+	if atomic.LoadInt32(&tracingFatal) > 0 {
+		fmt.Fprintf(os.Stderr, "could not export the build trace to --otel-endpoint %s: %v\n", otelEndpoint, err)
+		return
+	}
+	klog.Warningf("could not export the build trace to --otel-endpoint %s: %v", otelEndpoint, err)
+}
+
+// startTracing starts the root span of the build, exported with OTLP over gRPC to
+// --otel-endpoint.  The returned func ends it and flushes the spans.  klog.Fatal, which skips
+// the deferred calls, ends it as failed and flushes the spans too.
+func startTracing(name string) func() {
+	if len(otelEndpoint) == 0 {
+		return func() {}
+	}
+	otel.SetErrorHandler(otelErrorHandler{})
+	opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(otelEndpoint)}
+	if otelInsecure {
+		opts = append(opts, otlpgrpc.WithInsecure())
+	}
+	exporter, err := otlp.NewExporter(context.Background(), otlpgrpc.NewDriver(opts...))
+	if err != nil {
+		klog.Warningf("not tracing the build, could not start the exporter for --otel-endpoint %s: %v", otelEndpoint, err)
+		return func() {}
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewWithAttributes(semconv.ServiceNameKey.String("apiserver-boot"))),
+	)
+	otel.SetTracerProvider(provider)
+
+	var root trace.Span
+	traceCtx, root = tracer().Start(context.Background(), name, trace.WithAttributes(
+		attribute.String("version", projectVersion()),
+	))
+	var once sync.Once
+	end := func() {
+		once.Do(func() {
+			root.End()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := provider.Shutdown(ctx); err != nil {
+				warnExport(err)
+			}
+		})
+	}
+	onFatal(func() {
+		atomic.StoreInt32(&tracingFatal, 1)
+		root.SetStatus(codes.Error, "the build failed")
+		end()
+	})
+	return end
+}
+
+// startSpan starts the span of a build phase as a child of the root span
+func startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracer().Start(traceCtx, name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endSpan ends span, marking it as failed if err isn't nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
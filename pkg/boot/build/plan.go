@@ -0,0 +1,112 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+
+	"k8s.io/klog/v2"
+)
+
+// planStep is a single target of the build plan printed by --plan
+type planStep struct {
+	Target   string   `json:"target"`
+	Platform string   `json:"platform,omitempty"`
+	Source   string   `json:"source"`
+	Output   string   `json:"output"`
+	Env      []string `json:"env,omitempty"`
+	Command  []string `json:"command"`
+}
+
+// buildPlan returns the steps build executables runs with the current flags
+func buildPlan() []planStep {
+	if buildMode == "plugin" {
+		steps := []planStep{}
+		for _, p := range buildPlatforms() {
+			goos, goarch = p.OS, p.Arch
+			output := pluginOutput()
+			steps = append(steps, planStep{
+				Target:   "plugin",
+				Platform: targetOS() + "/" + targetArch(),
+				Source:   pluginPackage,
+				Output:   output,
+				Env:      pluginEnv(),
+				Command:  pluginCommand(output).Args,
+			})
+		}
+		return steps
+	}
+
+	steps := []planStep{}
+	env := userEnv()
+	if Bazel {
+		for _, t := range resolveTargets() {
+			output := filepath.Join("bin", filepath.Base(t.Dir))
+			if bazelNoCopy {
+				output = bazelOutput(t)
+			}
+			steps = append(steps, planStep{
+				Target:  t.Name,
+				Source:  t.Dir,
+				Output:  output,
+				Command: append([]string{"bazel"}, bazelArgs("build", t.Dir)...),
+			})
+		}
+		return steps
+	}
+	for _, p := range buildPlatforms() {
+		goos, goarch = p.OS, p.Arch
+		for _, t := range resolveTargets() {
+			output := filepath.Join(outputdir, targetDir(t), outputName(t))
+			source := filepath.Join(t.Dir, "main.go")
+			if t.Test {
+				source = t.Dir
+			}
+			steps = append(steps, planStep{
+				Target:   t.Name,
+				Platform: targetOS() + "/" + targetArch(),
+				Source:   source,
+				Output:   output,
+				Env:      targetEnv(t, env),
+				Command:  goBuildCommand(context.Background(), t, output, env).Args,
+			})
+		}
+	}
+	return steps
+}
+
+// writePlan writes the build plan to w as json
+func writePlan(w io.Writer) {
+	steps := buildPlan()
+	for i := range steps {
+		steps[i].Output = displayPath(steps[i].Output)
+		steps[i].Command = displayArgs(steps[i].Command)
+		for j, e := range steps[i].Env {
+			steps[i].Env[j] = redactEnv(e)
+		}
+	}
+	// keeps the <redacted> values readable
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+	if err := e.Encode(steps); err != nil {
+		klog.Fatal(err)
+	}
+}
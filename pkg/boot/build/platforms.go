@@ -0,0 +1,92 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var skipPlatformCheck bool
+
+// checkPlatforms exits if a platform being built for isn't supported by the go toolchain
+func checkPlatforms() {
+	known, err := distPlatforms(goBinary())
+	if err != nil {
+		klog.Fatalf("%v, use --skip-platform-check to build anyway", err)
+	}
+	if unknown := unknownPlatforms(buildPlatforms(), known); len(unknown) > 0 {
+		klog.Fatalf("%s does not support building for %s, see `go tool dist list`",
+			goBinary(), strings.Join(unknown, ", "))
+	}
+}
+
+// checkWasm exits if a platform combines wasm with an os other than js or wasip1, or if
+// --buildmode is not one wasm supports
+func checkWasm() {
+	for _, p := range buildPlatforms() {
+		goos, goarch := p.OS, p.Arch
+		if len(goos) == 0 {
+			goos = targetOS()
+		}
+		if len(goarch) == 0 {
+			goarch = targetArch()
+		}
+		wasmOS := goos == "js" || goos == "wasip1"
+		if wasmOS != (goarch == "wasm") {
+			klog.Fatalf("%s/%s is not a valid platform, wasm can only be built for js or wasip1", goos, goarch)
+		}
+		if wasmOS && len(buildMode) > 0 && buildMode != "default" && buildMode != "exe" {
+			klog.Fatalf("--buildmode %s is not supported for %s/%s", buildMode, goos, goarch)
+		}
+	}
+}
+
+// distPlatforms returns the os/arch platforms listed by `go tool dist list`
+func distPlatforms(gobin string) (map[string]bool, error) {
+	out, err := exec.Command(gobin, "tool", "dist", "list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the platforms supported by %s: %v", gobin, err)
+	}
+	known := map[string]bool{}
+	for _, p := range strings.Fields(string(out)) {
+		known[p] = true
+	}
+	return known, nil
+}
+
+// unknownPlatforms returns the platforms in ps which aren't in known.  Empty values
+// are the platform of the host or the GOOS and GOARCH environment.
+func unknownPlatforms(ps []platform, known map[string]bool) []string {
+	unknown := []string{}
+	for _, p := range ps {
+		goos, goarch := p.OS, p.Arch
+		if len(goos) == 0 {
+			goos = targetOS()
+		}
+		if len(goarch) == 0 {
+			goarch = targetArch()
+		}
+		if !known[goos+"/"+goarch] {
+			unknown = append(unknown, goos+"/"+goarch)
+		}
+	}
+	return unknown
+}
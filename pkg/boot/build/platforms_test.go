@@ -0,0 +1,56 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDistPlatforms(t *testing.T) {
+	known, err := distPlatforms("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"linux/amd64", "freebsd/amd64", "freebsd/arm64", "illumos/amd64", "plan9/amd64"} {
+		if !known[p] {
+			t.Errorf("expected %s to be listed by go tool dist list", p)
+		}
+	}
+}
+
+func TestUnknownPlatforms(t *testing.T) {
+	known := map[string]bool{"linux/amd64": true, "freebsd/amd64": true, "illumos/amd64": true}
+	tests := []struct {
+		platforms []platform
+		want      []string
+	}{
+		{
+			platforms: []platform{{OS: "freebsd", Arch: "amd64"}, {OS: "illumos", Arch: "amd64"}},
+			want:      []string{},
+		},
+		{
+			platforms: []platform{{OS: "freebsd", Arch: "amd64"}, {OS: "illumos", Arch: "arm64"}, {OS: "linux", Arch: "nope"}},
+			want:      []string{"illumos/arm64", "linux/nope"},
+		},
+	}
+	for _, test := range tests {
+		if got := unknownPlatforms(test.platforms, known); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("unknownPlatforms(%v) = %v, want %v", test.platforms, got, test.want)
+		}
+	}
+}
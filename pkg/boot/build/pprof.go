@@ -0,0 +1,61 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var withPprof bool
+
+// pprofTag is the build tag of the apiserver file serving net/http/pprof, created as
+// cmd/apiserver/pprof.go by apiserver-boot init repo
+const pprofTag = "pprof"
+
+// enablePprof adds the pprof build tag to GOFLAGS, so both go build and the generators
+// loading the packages see the file serving pprof
+func enablePprof() {
+	flags := []string{}
+	tagged := false
+	for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if strings.HasPrefix(f, "-tags=") {
+			f = f + "," + pprofTag
+			tagged = true
+		}
+		flags = append(flags, f)
+	}
+	if !tagged {
+		flags = append(flags, "-tags="+pprofTag)
+	}
+	os.Setenv("GOFLAGS", strings.Join(flags, " "))
+	klog.Infof("GOFLAGS=%s", os.Getenv("GOFLAGS"))
+
+	for _, t := range resolveTargets() {
+		if !isApiserverTarget(t.Name) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(t.Dir, "pprof.go")); err != nil {
+			klog.Warningf("--with-pprof has no effect on %s, %s doesn't exist.  "+
+				"Add a file with the %q build tag serving net/http/pprof, like the one created by apiserver-boot init repo.",
+				t.Name, filepath.Join(t.Dir, "pprof.go"), pprofTag)
+		}
+	}
+}
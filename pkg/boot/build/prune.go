@@ -0,0 +1,95 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var pruneModules bool
+
+// checkPrunedModules runs go mod tidy on a copy of go.mod and go.sum, and warns, or exits
+// with --strict, listing the modules required by go.mod which the build doesn't use
+func checkPrunedModules() {
+	b, err := ioutil.ReadFile("go.mod")
+	if err != nil {
+		klog.Fatalf("--prune-modules requires a go.mod: %v", err)
+	}
+	mod, err := modfile.Parse("go.mod", b, nil)
+	if err != nil {
+		klog.Fatalf("could not parse go.mod: %v", err)
+	}
+
+	dir, err := tempDir("", "apiserver-boot-prune-modules-")
+	if err != nil {
+		klog.Fatalf("could not create a temporary directory for --prune-modules: %v", err)
+	}
+	defer removeTempDir(dir)
+	modFile := filepath.Join(dir, "go.mod")
+	if err := copyFile("go.mod", modFile); err != nil {
+		klog.Fatal(err)
+	}
+	if _, err := os.Stat("go.sum"); err == nil {
+		if err := copyFile("go.sum", filepath.Join(dir, "go.sum")); err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	c := exec.Command(goBinary(), "mod", "tidy", "-modfile="+modFile)
+	c.Env = append(append(os.Environ(), userEnv()...), "GOWORK=off")
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	c.Stderr = util.Stderr
+	c.Stdout = util.Stdout
+	if err := c.Run(); err != nil {
+		klog.Fatalf("--prune-modules: go mod tidy failed: %v", err)
+	}
+	b, err = ioutil.ReadFile(modFile)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	tidy, err := modfile.Parse(modFile, b, nil)
+	if err != nil {
+		klog.Fatalf("could not parse the go.mod written by go mod tidy: %v", err)
+	}
+
+	used := map[string]bool{}
+	for _, r := range tidy.Require {
+		used[r.Mod.Path] = true
+	}
+	unused := []string{}
+	for _, r := range mod.Require {
+		if !used[r.Mod.Path] {
+			unused = append(unused, r.Mod.String())
+		}
+	}
+	if len(unused) == 0 {
+		return
+	}
+	msg := "--prune-modules: go.mod requires modules the build doesn't use, remove them with go mod tidy:\n" + strings.Join(unused, "\n")
+	if strict {
+		klog.Fatal(msg)
+	}
+	klog.Warning(msg)
+}
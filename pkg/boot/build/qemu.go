@@ -0,0 +1,111 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var setupQemu bool
+var buildxPush bool
+
+// binfmtImage registers the qemu emulators of the docker daemon with the kernel binfmt_misc,
+// and lists the platforms the daemon can run when run without arguments.  It is pinned, so the
+// emulators registered with the privileged container don't change underneath the builds.
+const binfmtImage = "tonistiigi/binfmt:qemu-v7.0.0"
+
+// checkQemuPlatforms exits if the --platforms of the --setup-qemu image aren't linux platforms
+// docker buildx can build the image for, defaulting them to linux/amd64
+func checkQemuPlatforms() {
+	if len(platforms) == 0 {
+		platforms = []string{"linux/amd64"}
+	}
+	for _, p := range buildPlatforms() {
+		if p.OS != "linux" {
+			klog.Fatalf("--platforms of the --setup-qemu image must be linux/<arch>, got %s/%s", p.OS, p.Arch)
+		}
+	}
+	if len(platforms) > 1 && !buildxPush {
+		klog.Fatalf("--setup-qemu with more than one of --platforms builds an image index, which docker can't load, push it with --push")
+	}
+	if len(platforms) > 1 && len(loadInto) > 0 {
+		klog.Fatalf("--load-into loads the image from the docker daemon and can't be used with more than one of --platforms")
+	}
+}
+
+// buildxArgs returns the docker args building the image for the --platforms, pushing it with
+// --push and loading it into the docker daemon otherwise
+func buildxArgs() []string {
+	args := []string{"buildx", "build", "--platform", strings.Join(platforms, ",")}
+	if buildxPush {
+		return append(args, "--push")
+	}
+	return append(args, "--load")
+}
+
+// setupEmulation registers the qemu emulators with binfmtImage unless the docker daemon
+// can already run images for each of platforms, e.g. linux/arm64
+func setupEmulation(platforms []string) {
+	out, err := exec.Command("docker", "version", "--format", "{{ .Server.Os }}/{{ .Server.Arch }}").Output()
+	if err != nil {
+		klog.Fatalf("--setup-qemu: could not get the platform of the docker daemon: %v", err)
+	}
+	host := strings.TrimSpace(string(out))
+	emulated := []string{}
+	for _, p := range platforms {
+		if p != host {
+			emulated = append(emulated, p)
+		}
+	}
+	if len(emulated) == 0 {
+		klog.Infof("--setup-qemu: the docker daemon runs %s images natively, skipping the qemu setup", host)
+		return
+	}
+
+	out, err = exec.Command("docker", "run", "--rm", "--privileged", binfmtImage).Output()
+	if err != nil {
+		klog.Fatalf("--setup-qemu: could not list the platforms the docker daemon can run with %s: %v", binfmtImage, err)
+	}
+	status := struct {
+		Supported []string `json:"supported"`
+	}{}
+	if err := json.Unmarshal(out, &status); err != nil {
+		klog.Fatalf("--setup-qemu: could not read the platforms listed by %s: %v", binfmtImage, err)
+	}
+	supported := map[string]bool{}
+	for _, p := range status.Supported {
+		supported[p] = true
+	}
+	missing := []string{}
+	for _, p := range emulated {
+		if !supported[p] {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) == 0 {
+		klog.Infof("--setup-qemu: emulation of %s is already registered", strings.Join(emulated, ", "))
+		return
+	}
+
+	klog.Infof("Registering the qemu emulators to build %s images", strings.Join(missing, ", "))
+	util.DoCmd("docker", "run", "--rm", "--privileged", binfmtImage, "--install", "all")
+}
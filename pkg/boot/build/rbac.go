@@ -0,0 +1,136 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+var verifyRBAC bool
+var rbacRoleFile string
+var rbacRoleName string
+var rbacPaths string
+
+// yamlSeparator splits the documents of a yaml file
+var yamlSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// checkRBAC regenerates the roles of the +kubebuilder:rbac markers with controller-gen into a
+// temporary directory and fails listing the rules missing from or extra in --rbac-role
+func checkRBAC() {
+	if _, err := exec.LookPath("controller-gen"); err != nil {
+		klog.Fatalf("--verify-rbac requires controller-gen, install it with " +
+			"`go install sigs.k8s.io/controller-tools/cmd/controller-gen@latest`")
+	}
+	tmp, err := tempDir("", "apiserver-boot-verify-rbac-")
+	if err != nil {
+		klog.Fatalf("could not create a directory to generate the RBAC roles into: %v", err)
+	}
+	defer removeTempDir(tmp)
+	runGenerateCommand("controller-gen", "rbac:roleName="+rbacRoleName, "paths="+rbacPaths, "output:rbac:dir="+tmp)
+
+	want, err := rbacRules(filepath.Join(tmp, "role.yaml"))
+	if err != nil {
+		klog.Fatalf("could not read the roles generated by controller-gen: %v", err)
+	}
+	got, err := rbacRules(rbacRoleFile)
+	if err != nil {
+		klog.Fatalf("--verify-rbac: %v", err)
+	}
+	missing, extra := []string{}, []string{}
+	for r := range want {
+		if !got[r] {
+			missing = append(missing, r)
+		}
+	}
+	for r := range got {
+		if !want[r] {
+			extra = append(extra, r)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		klog.Infof("%s matches the +kubebuilder:rbac markers", rbacRoleFile)
+		return
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	msg := fmt.Sprintf("--verify-rbac: %s doesn't match the +kubebuilder:rbac markers, regenerate it with "+
+		"`controller-gen rbac:roleName=%s paths=%s output:rbac:dir=%s`", rbacRoleFile, rbacRoleName, rbacPaths, filepath.Dir(rbacRoleFile))
+	if len(missing) > 0 {
+		msg += "\nmissing rules:\n  " + strings.Join(missing, "\n  ")
+	}
+	if len(extra) > 0 {
+		msg += "\nextra rules:\n  " + strings.Join(extra, "\n  ")
+	}
+	klog.Fatal(msg)
+}
+
+// rbacRules returns each verb a Role or ClusterRole of the yaml file grants on a resource or
+// non-resource URL, prefixed by the kind, namespace and name of the role
+func rbacRules(path string) (map[string]bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	rules := map[string]bool{}
+	for _, doc := range yamlSeparator.Split(string(b), -1) {
+		if len(strings.TrimSpace(doc)) == 0 {
+			continue
+		}
+		role := rbacv1.ClusterRole{}
+		if err := yaml.Unmarshal([]byte(doc), &role); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", path, err)
+		}
+		if role.Kind != "ClusterRole" && role.Kind != "Role" {
+			continue
+		}
+		prefix := role.Kind + " " + role.Name
+		if len(role.Namespace) > 0 {
+			prefix = role.Kind + " " + role.Namespace + "/" + role.Name
+		}
+		for _, rule := range role.Rules {
+			for _, verb := range rule.Verbs {
+				for _, url := range rule.NonResourceURLs {
+					rules[fmt.Sprintf("%s: %s %s", prefix, verb, url)] = true
+				}
+				for _, group := range rule.APIGroups {
+					for _, resource := range rule.Resources {
+						if len(group) > 0 {
+							resource += "." + group
+						}
+						if len(rule.ResourceNames) == 0 {
+							rules[fmt.Sprintf("%s: %s %s", prefix, verb, resource)] = true
+						}
+						for _, name := range rule.ResourceNames {
+							rules[fmt.Sprintf("%s: %s %s/%s", prefix, verb, resource, name)] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildKeyConfigChange(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary several times")
+	}
+	defer func(old string) { ldflags = old }(ldflags)
+	t.Setenv("GOFLAGS", "")
+
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"go.mod":   "module example.com/app\n\ngo 1.17\n",
+		"main.go":  "package main\n\nvar value = \"stable-channel\"\n\nfunc main() { println(value) }\n",
+		"alpha.go": "//go:build alpha\n\npackage main\n\nfunc init() { value = \"alpha-channel\" }\n",
+	})
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(src); err != nil {
+		t.Fatal(err)
+	}
+	// the builds share a build cache, like the builds of a project do
+	cache := "GOCACHE=" + filepath.Join(t.TempDir(), "cache")
+	output := filepath.Join(t.TempDir(), "app")
+	target := buildTarget{Name: "app", Dir: "."}
+	key := func(env ...string) string {
+		k, err := buildKey(target, append(env, cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	ldflags = ""
+	stable := key()
+	if b := buildProgram(t, src, output, []string{cache}); !bytes.Contains(b, []byte("stable-channel")) {
+		t.Fatalf("binary doesn't contain the default value")
+	}
+	if key() != stable {
+		t.Errorf("the key of the same configuration changed")
+	}
+
+	ldflags = "-X main.value=ldflags-channel"
+	if key() == stable {
+		t.Errorf("changing only --ldflags didn't change the key")
+	}
+	if b := buildProgram(t, src, output, []string{cache}); !bytes.Contains(b, []byte("ldflags-channel")) {
+		t.Errorf("changing only --ldflags didn't rebuild the binary with the new value")
+	}
+
+	ldflags = ""
+	if key("GOFLAGS=-tags=alpha") == stable {
+		t.Errorf("changing only the build tags in the environment didn't change the key")
+	}
+	if key() != stable {
+		t.Errorf("the key of the first configuration changed")
+	}
+
+	if err := ioutil.WriteFile("main.go", []byte("package main\n\nvar value = \"edited\"\n\nfunc main() { println(value) }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if key() == stable {
+		t.Errorf("changing only the source didn't change the key")
+	}
+}
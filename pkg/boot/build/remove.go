@@ -0,0 +1,81 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var followSymlinks bool
+
+// removeAll removes path like os.RemoveAll, unless a directory of the path below the working
+// directory is a symlink, e.g. bin linked to a directory shared with other projects, which
+// os.RemoveAll would remove the files of.  Those paths are only removed with --follow-symlinks.
+// A symlink at path itself is removed without removing what it links to.
+func removeAll(path string) {
+	if link := symlinkDir(path); len(link) > 0 && !followSymlinks {
+		klog.Warningf("Not removing %s, %s is a symlink.  Use --follow-symlinks to remove the files it links to.", path, link)
+		return
+	}
+	os.RemoveAll(path)
+}
+
+// checkSymlinkOutput returns an error if writing path, e.g. installing a binary into bin, writes
+// through a symlinked directory below the working directory, replacing the files of the directory
+// it links to, unless --follow-symlinks is set
+func checkSymlinkOutput(path string) error {
+	if link := symlinkDir(path); len(link) > 0 && !followSymlinks {
+		return fmt.Errorf("not writing %s, %s is a symlink.  Use --follow-symlinks to replace the files it links to.", path, link)
+	}
+	return nil
+}
+
+// symlinkDir returns the first directory of path below the working directory which is a
+// symlink, relative to the working directory, or nothing if there isn't one or path isn't
+// below the working directory
+func symlinkDir(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	dir := ""
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, p := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, p)
+		info, err := os.Lstat(filepath.Join(wd, dir))
+		if err != nil {
+			return ""
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return dir
+		}
+	}
+	return ""
+}
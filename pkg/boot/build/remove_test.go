@@ -0,0 +1,74 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSymlinkOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiserver-boot-symlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	// bin links to a directory shared with other projects
+	if err := os.Mkdir("shared", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("shared", "bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("out", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(follow bool) { followSymlinks = follow }(followSymlinks)
+	tests := []struct {
+		path   string
+		follow bool
+		fails  bool
+	}{
+		{path: filepath.Join("bin", "apiserver"), fails: true},
+		{path: filepath.Join("bin", "linux_amd64", "apiserver"), fails: true},
+		{path: filepath.Join("bin", "apiserver"), follow: true},
+		{path: filepath.Join("out", "apiserver")},
+		// the symlink itself is replaced rather than written through
+		{path: "bin"},
+	}
+	for _, test := range tests {
+		followSymlinks = test.follow
+		err := checkSymlinkOutput(test.path)
+		if test.fails && err == nil {
+			t.Errorf("expected writing %s with --follow-symlinks=%v to fail", test.path, test.follow)
+		}
+		if !test.fails && err != nil {
+			t.Errorf("writing %s with --follow-symlinks=%v: %v", test.path, test.follow, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+// runtimeModule is the module of the apiserver-builder runtime library
+const runtimeModule = "sigs.k8s.io/apiserver-runtime"
+
+var runtimeReplace string
+
+// runtimeModFile is the copy of go.mod replacing runtimeModule with --runtime-replace which
+// the targets are built with
+var runtimeModFile string
+
+// setupRuntimeReplace writes a copy of go.mod and go.sum replacing runtimeModule with the
+// --runtime-replace checkout, and returns a func removing it.  go.mod itself is never edited,
+// so it is left as is however the build ends.
+func setupRuntimeReplace() func() {
+	dir, err := filepath.Abs(runtimeReplace)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		klog.Fatalf("--runtime-replace %s must be a checkout of %s: %v", runtimeReplace, runtimeModule, err)
+	}
+	if m := modfile.ModulePath(b); m != runtimeModule {
+		klog.Fatalf("--runtime-replace %s must be a checkout of %s, its go.mod is of %q", runtimeReplace, runtimeModule, m)
+	}
+
+	tmp, err := tempDir("", "apiserver-boot-runtime-replace-")
+	if err != nil {
+		klog.Fatalf("could not create a directory for the go.mod of --runtime-replace: %v", err)
+	}
+	runtimeModFile = filepath.Join(tmp, "go.mod")
+	if err := copyFile("go.mod", runtimeModFile); err != nil {
+		klog.Fatal(err)
+	}
+	if _, err := os.Stat("go.sum"); err == nil {
+		if err := copyFile("go.sum", filepath.Join(tmp, "go.sum")); err != nil {
+			klog.Fatal(err)
+		}
+	}
+	env := append(os.Environ(), userEnv()...)
+	env = append(env, "GOWORK=off")
+	c := exec.Command(goBinary(), "mod", "edit", "-modfile="+runtimeModFile, "-replace="+runtimeModule+"="+dir)
+	if err := runMatrixCommand(c, env); err != nil {
+		klog.Fatalf("could not replace %s with --runtime-replace %s: %v", runtimeModule, runtimeReplace, err)
+	}
+
+	// confirm the build resolves the module to the checkout
+	c = exec.Command(goBinary(), "list", "-modfile="+runtimeModFile, "-mod=mod", "-m", "-f", "{{ with .Replace }}{{ .Dir }}{{ end }}", runtimeModule)
+	c.Env = env
+	c.Stderr = util.Stderr
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	out, err := c.Output()
+	if err != nil {
+		klog.Fatalf("could not resolve %s with --runtime-replace %s: %v", runtimeModule, runtimeReplace, err)
+	}
+	if got := strings.TrimSpace(string(out)); got != dir {
+		klog.Fatalf("--runtime-replace: the build resolves %s to %q instead of %s", runtimeModule, got, dir)
+	}
+	klog.Infof("Building with %s replaced by %s, go.mod is left as is", runtimeModule, dir)
+	return func() {
+		runtimeModFile = ""
+		removeTempDir(tmp)
+	}
+}
+
+// runtimeReplaceArgs returns the go build arguments building with the go.mod of --runtime-replace
+func runtimeReplaceArgs() []string {
+	if len(runtimeModFile) == 0 {
+		return nil
+	}
+	args := []string{"-modfile=" + runtimeModFile}
+	if len(modMode) == 0 {
+		// the replacement may need go.sum entries the project doesn't have
+		args = append(args, "-mod=mod")
+	}
+	return args
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var sbom bool
+var sbomFormat string
+
+// goModule is a dependency module compiled into a binary, listed by go version -m
+type goModule struct {
+	Path    string
+	Version string
+	// Sum is the go.sum h1: hash of the module, a SHA-256 of the hashes of the files of
+	// the module rather than of an artifact
+	Sum string
+}
+
+// purl returns the package URL of the module
+func (m goModule) purl() string {
+	return fmt.Sprintf("pkg:golang/%s@%s", m.Path, m.Version)
+}
+
+// writeSBOMs writes a CycloneDX or SPDX SBOM of the modules compiled into each binary next to it
+func writeSBOMs() {
+	for _, a := range artifacts {
+		t, found := lookupTarget(a.Target)
+		if !found || t.Test {
+			continue
+		}
+		deps, err := binaryModules(a.Path)
+		if err != nil {
+			klog.Fatalf("could not list the modules of %s for --sbom: %v", a.Path, err)
+		}
+		var doc interface{}
+		path := a.Path + ".cdx.json"
+		if sbomFormat == "spdx" {
+			doc = spdxDocument(filepath.Base(a.Path), deps)
+			path = a.Path + ".spdx.json"
+		} else {
+			doc = cyclonedxDocument(filepath.Base(a.Path), deps)
+		}
+		b, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			klog.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+			klog.Fatalf("could not write the SBOM %s: %v", path, err)
+		}
+		klog.Infof("Wrote the SBOM of %s to %s", displayPath(a.Path), displayPath(path))
+	}
+}
+
+// binaryModules returns the dependency modules recorded in the build info of the binary at
+// path, as their replacements if they are replaced by another module version, so they are the modules the binary was
+// built from whatever the environment, tags and go.mod of the build were
+func binaryModules(path string) ([]goModule, error) {
+	c := exec.Command(goBinary(), "version", "-m", path)
+	c.Stderr = util.Stderr
+	klog.Infof("%s", strings.Join(displayArgs(c.Args), " "))
+	out, err := c.Output()
+	if err != nil {
+		return nil, err
+	}
+	deps := []goModule{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		m := goModule{Path: fields[1], Version: fields[2]}
+		if len(fields) > 3 {
+			m.Sum = fields[3]
+		}
+		switch fields[0] {
+		case "dep":
+			deps = append(deps, m)
+		case "=>":
+			// directory replacements have no version, the module is listed as required
+			if len(deps) > 0 && m.Version != "(devel)" {
+				deps[len(deps)-1] = m
+			}
+		}
+	}
+	return deps, nil
+}
+
+// cyclonedxDocument returns a CycloneDX 1.4 SBOM of the binary name built from modules
+func cyclonedxDocument(name string, modules []goModule) map[string]interface{} {
+	components := []map[string]interface{}{}
+	for _, m := range modules {
+		c := map[string]interface{}{
+			"type":    "library",
+			"bom-ref": m.purl(),
+			"name":    m.Path,
+			"version": m.Version,
+			"purl":    m.purl(),
+		}
+		if len(m.Sum) > 0 {
+			c["properties"] = []map[string]string{{"name": "golang:go.sum", "value": m.Sum}}
+		}
+		components = append(components, c)
+	}
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.4",
+		"serialNumber": "urn:uuid:" + uuid.New().String(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": buildStart.UTC().Format(time.RFC3339),
+			"tools":     []map[string]string{{"name": "apiserver-boot"}},
+			"component": map[string]string{
+				"type":    "application",
+				"name":    name,
+				"version": projectVersion(),
+			},
+		},
+		"components": components,
+	}
+}
+
+// spdxDocument returns an SPDX 2.3 SBOM of the binary name built from modules
+func spdxDocument(name string, modules []goModule) map[string]interface{} {
+	packages := []map[string]interface{}{{
+		"SPDXID":           "SPDXRef-Package-binary",
+		"name":             name,
+		"versionInfo":      projectVersion(),
+		"downloadLocation": "NOASSERTION",
+		"filesAnalyzed":    false,
+	}}
+	relationships := []map[string]string{{
+		"spdxElementId":      "SPDXRef-DOCUMENT",
+		"relationshipType":   "DESCRIBES",
+		"relatedSpdxElement": "SPDXRef-Package-binary",
+	}}
+	for i, m := range modules {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i)
+		p := map[string]interface{}{
+			"SPDXID":           id,
+			"name":             m.Path,
+			"versionInfo":      m.Version,
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed":    false,
+			"externalRefs": []map[string]string{{
+				"referenceCategory": "PACKAGE-MANAGER",
+				"referenceType":     "purl",
+				"referenceLocator":  m.purl(),
+			}},
+		}
+		if len(m.Sum) > 0 {
+			p["comment"] = "go.sum hash " + m.Sum
+		}
+		packages = append(packages, p)
+		relationships = append(relationships, map[string]string{
+			"spdxElementId":      "SPDXRef-Package-binary",
+			"relationshipType":   "DEPENDS_ON",
+			"relatedSpdxElement": id,
+		})
+	}
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              name,
+		"documentNamespace": "https://sigs.k8s.io/apiserver-builder-alpha/spdx/" + name + "-" + uuid.New().String(),
+		"creationInfo": map[string]interface{}{
+			"created":  buildStart.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: apiserver-boot"},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
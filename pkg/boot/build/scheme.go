@@ -0,0 +1,215 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var verifyScheme bool
+
+type schemeCheckArguments struct {
+	Runtime  bool
+	Packages []schemeCheckPackage
+}
+
+type schemeCheckPackage struct {
+	Alias       string
+	Path        string
+	AddToScheme bool
+	Kinds       []string
+}
+
+// runSchemeCheck runs a generated test registering the types of each API version with its
+// AddToScheme, and with the apiserver-runtime resource.AddToScheme for the resources, and
+// fails listing the types embedding metav1.TypeMeta which aren't registered
+func runSchemeCheck() {
+	args := schemeCheckArguments{Runtime: requiresModule(runtimeModule)}
+	for _, api := range versionedAPIs {
+		dir := filepath.Join("pkg", "apis", api)
+		kinds := typeMetaTypes(dir)
+		if len(kinds) == 0 {
+			continue
+		}
+		args.Packages = append(args.Packages, schemeCheckPackage{
+			Alias:       aliasFor(api),
+			Path:        path.Join(util.GetRepo(), "pkg", "apis", filepath.ToSlash(api)),
+			AddToScheme: hasAddToScheme(dir),
+			Kinds:       kinds,
+		})
+	}
+	if len(args.Packages) == 0 {
+		klog.Infof("No types embedding metav1.TypeMeta found under pkg/apis, skipping --verify-scheme")
+		return
+	}
+
+	// the test must be in the module to import the API packages
+	dir, err := tempDir(".", "_apiserver-boot-verify-scheme-")
+	if err != nil {
+		klog.Fatalf("could not create a directory for the scheme registration test: %v", err)
+	}
+	util.WriteIfNotFound(filepath.Join(dir, "scheme_test.go"), "verify-scheme-template", schemeCheckTemplate, args)
+
+	c := generateCommand(goBinary(), "test", "-count=1", "./"+filepath.ToSlash(dir))
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	err = c.Run()
+	removeTempDir(dir)
+	if err != nil && generateCtx.Err() != nil {
+		generateFailed("the --verify-scheme go test", err)
+	}
+	if err != nil {
+		klog.Fatalf("--verify-scheme: types of the API versions aren't registered in the scheme, add them to AddToScheme: %v", err)
+	}
+}
+
+// typeMetaTypes returns the exported struct types of the go files in dir which embed metav1.TypeMeta
+func typeMetaTypes(dir string) []string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	kinds := []string{}
+	fset := token.NewFileSet()
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") || strings.HasPrefix(filepath.Base(f), "zz_generated.") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, f, nil, 0)
+		if err != nil {
+			klog.Fatalf("could not parse %s: %v", f, err)
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok || !ts.Name.IsExported() {
+					continue
+				}
+				for _, field := range st.Fields.List {
+					if sel, ok := field.Type.(*ast.SelectorExpr); ok && len(field.Names) == 0 && sel.Sel.Name == "TypeMeta" {
+						kinds = append(kinds, ts.Name.Name)
+						break
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// requiresModule returns true if the go.mod of the project requires the module m
+func requiresModule(m string) bool {
+	b, err := ioutil.ReadFile("go.mod")
+	if err != nil {
+		return false
+	}
+	mod, err := modfile.Parse("go.mod", b, nil)
+	if err != nil {
+		klog.Fatalf("could not parse go.mod: %v", err)
+	}
+	for _, r := range mod.Require {
+		if r.Mod.Path == m {
+			return true
+		}
+	}
+	return false
+}
+
+var schemeCheckTemplate = `// Code generated by apiserver-boot build executables --verify-scheme. DO NOT EDIT.
+
+package verifyscheme
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+{{- if .Runtime }}
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
+{{- end }}
+{{ range .Packages }}	{{ .Alias }} "{{ .Path }}"
+{{ end }})
+
+type apiPackage struct {
+	path        string
+	addToScheme func(*runtime.Scheme) error
+	kinds       map[string]interface{}
+}
+
+var packages = []apiPackage{
+{{ range .Packages }}	{
+		path: "{{ .Path }}",
+{{ if .AddToScheme }}		addToScheme: {{ .Alias }}.AddToScheme,
+{{ end }}		kinds: map[string]interface{}{
+{{ $alias := .Alias }}{{ range .Kinds }}			"{{ . }}": &{{ $alias }}.{{ . }}{},
+{{ end }}		},
+	},
+{{ end }}}
+
+func TestSchemeRegistration(t *testing.T) {
+	unregistered := []string{}
+	for _, p := range packages {
+		scheme := runtime.NewScheme()
+		if p.addToScheme != nil {
+			if err := p.addToScheme(scheme); err != nil {
+				t.Errorf("%s AddToScheme failed: %v", p.path, err)
+				continue
+			}
+		}
+{{- if .Runtime }}
+		resources := []resource.Object{}
+		for _, k := range p.kinds {
+			if r, ok := k.(resource.Object); ok {
+				resources = append(resources, r)
+			}
+		}
+		if err := resource.AddToScheme(resources...)(scheme); err != nil {
+			t.Errorf("%s resource.AddToScheme failed: %v", p.path, err)
+			continue
+		}
+{{- end }}
+		for name, k := range p.kinds {
+			obj, ok := k.(runtime.Object)
+			if !ok {
+				unregistered = append(unregistered, p.path+"."+name+" (not a runtime.Object, is its deepcopy code generated?)")
+				continue
+			}
+			if _, _, err := scheme.ObjectKinds(obj); err != nil {
+				unregistered = append(unregistered, p.path+"."+name)
+			}
+		}
+	}
+	if len(unregistered) > 0 {
+		sort.Strings(unregistered)
+		t.Errorf("types not registered in the scheme:\n  %s", strings.Join(unregistered, "\n  "))
+	}
+}
+`
@@ -0,0 +1,93 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var sign bool
+var cosignKey string
+var notationKey string
+
+// AddSignFlags adds the flags for signing an image after it is pushed
+func AddSignFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&sign, "sign", false, "if true, sign the pushed image with cosign, keyless unless --cosign-key is set")
+	cmd.Flags().StringVar(&cosignKey, "cosign-key", "", "if specified, the key --sign signs the image with, e.g. cosign.key or a KMS URI")
+	cmd.Flags().StringVar(&notationKey, "notation-key", "", "if specified, sign the pushed image with notation using this key.  "+
+		"May be used with --sign to add both signatures.")
+}
+
+// Signing returns true if the sign flags select a signer, which needs the image to be pushed
+func Signing() bool {
+	return sign || len(notationKey) > 0
+}
+
+// SignImage signs the pushed image with each of the signers selected by the sign flags
+func SignImage(image string) {
+	if len(cosignKey) > 0 && !sign {
+		klog.Fatalf("--cosign-key requires --sign")
+	}
+	if !Signing() {
+		return
+	}
+	// check the CLIs before signing, so the image isn't left with only one of the signatures
+	if _, err := exec.LookPath("cosign"); sign && err != nil {
+		klog.Fatalf("--sign requires the cosign CLI, install it from https://docs.sigstore.dev/cosign/system_config/installation/")
+	}
+	if _, err := exec.LookPath("notation"); len(notationKey) > 0 && err != nil {
+		klog.Fatalf("--notation-key requires the notation CLI, install it from https://notaryproject.dev/docs/installation/cli/")
+	}
+	ref := pushedDigest(image)
+	if sign {
+		args := []string{"sign", "--yes"}
+		if len(cosignKey) > 0 {
+			args = append(args, "--key", cosignKey)
+		}
+		util.DoCmd("cosign", append(args, ref)...)
+	}
+	if len(notationKey) > 0 {
+		util.DoCmd("notation", "sign", "--key", notationKey, ref)
+	}
+}
+
+// pushedDigest returns the image pushed as image referenced by its digest in the registry,
+// so the signature covers the pushed content rather than a tag which can move
+func pushedDigest(image string) string {
+	c := exec.Command("docker", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", image)
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	out, err := c.Output()
+	if err != nil {
+		klog.Fatalf("could not find the digest of %s: %v", image, err)
+	}
+	repo := image
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repo = image[:i]
+	}
+	for _, d := range strings.Fields(string(out)) {
+		if strings.HasPrefix(d, repo+"@") {
+			return d
+		}
+	}
+	klog.Fatalf("could not find the digest %s was pushed with", image)
+	return ""
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+var maxSize string
+var maxSizeApiserver string
+var maxSizeController string
+var strip bool
+
+// parseSize parses a --max-size quantity, also accepting a trailing B, e.g. 80MiB
+func parseSize(flag, value string) int64 {
+	q, err := resource.ParseQuantity(strings.TrimSuffix(value, "B"))
+	if err != nil {
+		klog.Fatalf("invalid --%s %q: %v", flag, value, err)
+	}
+	return q.Value()
+}
+
+// hasSizeBudgets returns true if a --max-size budget is set
+func hasSizeBudgets() bool {
+	return len(maxSize) > 0 || len(maxSizeApiserver) > 0 || len(maxSizeController) > 0
+}
+
+// checkMaxSizes exits if a --max-size budget isn't a quantity, before building
+func checkMaxSizes() {
+	budgets := map[string]string{
+		"max-size":            maxSize,
+		"max-size-apiserver":  maxSizeApiserver,
+		"max-size-controller": maxSizeController,
+	}
+	for flag, budget := range budgets {
+		if len(budget) > 0 {
+			parseSize(flag, budget)
+		}
+	}
+}
+
+// checkBinarySizes exits listing the binaries of as larger than the --max-size budget of their
+// target.  Staged binaries are checked before they are installed, so they don't replace the
+// binaries of the output directory.
+func checkBinarySizes(as []artifact) {
+	over := []string{}
+	for _, a := range as {
+		flag, budget := "max-size", maxSize
+		switch {
+		case isApiserverTarget(a.Target) && len(maxSizeApiserver) > 0:
+			flag, budget = "max-size-apiserver", maxSizeApiserver
+		case a.Target == controllerTarget && len(maxSizeController) > 0:
+			flag, budget = "max-size-controller", maxSizeController
+		}
+		if len(budget) == 0 {
+			continue
+		}
+		info, err := os.Stat(a.Path)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		if info.Size() <= parseSize(flag, budget) {
+			continue
+		}
+		name := a.Path
+		if len(stageDir) > 0 && strings.HasPrefix(a.Path, stageDir+string(filepath.Separator)) {
+			name = installPath(a)
+		}
+		klog.Errorf("%s is %.1fMiB, larger than --%s %s", displayPath(name), float64(info.Size())/(1<<20), flag, budget)
+		over = append(over, displayPath(name))
+	}
+	if len(over) > 0 {
+		klog.Fatalf("binaries exceed their size budget: %s", strings.Join(over, ", "))
+	}
+}
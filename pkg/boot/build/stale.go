@@ -0,0 +1,110 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var generateIfStale bool
+
+// generateStampName is the file written to the output directory after the code generation,
+// recording the flags it ran with
+const generateStampName = ".apiserver-boot-generated"
+
+// generateStale returns why the code generation needs to run for --generate-if-stale, or
+// nothing if it last ran with the same flags after the API types under pkg/apis changed
+func generateStale() string {
+	stamp := filepath.Join(outputdir, generateStampName)
+	info, err := os.Stat(stamp)
+	if err != nil {
+		return fmt.Sprintf("%s doesn't exist", stamp)
+	}
+	b, err := ioutil.ReadFile(stamp)
+	if err != nil {
+		return fmt.Sprintf("could not read %s: %v", stamp, err)
+	}
+	if strings.TrimSpace(string(b)) != generateFlagsDigest() {
+		return "the code generation flags changed"
+	}
+	for _, f := range generateInputs() {
+		if i, err := os.Stat(f); err == nil && i.ModTime().After(info.ModTime()) {
+			return fmt.Sprintf("%s changed", f)
+		}
+	}
+	return ""
+}
+
+// writeGenerateStamp records that the code generation ran with the current flags
+func writeGenerateStamp() {
+	if err := os.MkdirAll(outputdir, 0755); err != nil {
+		klog.Fatalf("could not create --output directory %s: %v", outputdir, err)
+	}
+	stamp := filepath.Join(outputdir, generateStampName)
+	if err := ioutil.WriteFile(stamp, []byte(generateFlagsDigest()+"\n"), 0644); err != nil {
+		klog.Fatalf("could not write %s: %v", stamp, err)
+	}
+}
+
+// generateInputs returns the files under pkg/apis which aren't generated, and the boilerplate
+// header of the generated code
+func generateInputs() []string {
+	files := []string{filepath.Join("hack", "boilerplate.go.txt")}
+	filepath.Walk(filepath.Join("pkg", "apis"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		if strings.HasPrefix(name, "zz_generated.") || strings.HasPrefix(name, "generated.") {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files
+}
+
+// generateFlagsDigest returns the sha256 of the flags selecting what the code generation writes
+func generateFlagsDigest() string {
+	flags := []string{
+		fmt.Sprintf("with-proto=%v", withProto),
+		fmt.Sprintf("protoc=%s", protocPath),
+		fmt.Sprintf("vendor-dir=%s", vendorDir),
+		fmt.Sprintf("with-crds=%v", withCRDs),
+		fmt.Sprintf("crd-dir=%s", crdDir),
+		fmt.Sprintf("verify-generated=%v", verifyGenerated),
+		fmt.Sprintf("with-conversion-fuzz=%v", withConversionFuzz),
+		fmt.Sprintf("verify-scheme=%v", verifyScheme),
+		fmt.Sprintf("aggregation-routes=%s", strings.Join(aggregationRoutes, ",")),
+		fmt.Sprintf("storage-version=%s", strings.Join(storageVersions, ",")),
+		fmt.Sprintf("default-admission=%s", strings.Join(defaultAdmission, ",")),
+		fmt.Sprintf("verify-openapi=%v", verifyOpenAPI),
+	}
+	for _, t := range resolveTargets() {
+		flags = append(flags, fmt.Sprintf("target=%s:%s:%s", t.Name, t.Group, t.Dir))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(flags, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var storageVersions []string
+
+// storageVersionsFile is the file of the storage versions in the apiserver target directories
+const storageVersionsFile = "zz_generated.storage_versions.go"
+
+type storageVersion struct {
+	Alias string
+	Path  string
+	Kind  string
+}
+
+type storageVersionsTemplateArguments struct {
+	Imports  map[string]string
+	Versions []storageVersion
+}
+
+// generateStorageVersions checks the --storage-version versions are registered under pkg/apis, and
+// writes the storage versions of the API groups served by each apiserver target to its directory
+func generateStorageVersions() {
+	registered := map[string]bool{}
+	for _, api := range versionedAPIs {
+		registered[filepath.ToSlash(api)] = true
+	}
+	groups := map[string]string{}
+	for _, v := range storageVersions {
+		if !registered[v] {
+			known := []string{}
+			for k := range registered {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			klog.Fatalf("--storage-version %q is not a version under pkg/apis, must be one of %q", v, known)
+		}
+		group := path.Dir(v)
+		if prev, found := groups[group]; found && prev != v {
+			klog.Fatalf("--storage-version %q and %q select more than one storage version of API group %s", prev, v, group)
+		}
+		groups[group] = v
+	}
+
+	for _, t := range resolveTargets() {
+		if t.Name != apiserverTarget && len(t.Group) == 0 {
+			continue
+		}
+		data := storageVersionsTemplateArguments{Imports: map[string]string{}}
+		for _, v := range storageVersions {
+			group := path.Dir(v)
+			if len(t.Group) > 0 && group != t.Group {
+				continue
+			}
+			alias := aliasFor(group + path.Base(v))
+			data.Imports[alias] = path.Join(util.GetRepo(), "pkg", "apis", v)
+			data.Versions = append(data.Versions, storageVersion{Alias: alias, Path: v, Kind: storageVersionKind(v)})
+		}
+		if len(data.Versions) == 0 {
+			continue
+		}
+		generated := filepath.Join(t.Dir, storageVersionsFile)
+		klog.Infof("Writing the storage versions of %s to %s", t.Name, generated)
+		util.Overwrite(generated, "storage-versions-template", storageVersionsTemplate, data)
+		recordGenerated(generated)
+	}
+}
+
+// storageVersionKind returns a resource.Object kind of the API version, which the generated
+// code gets the group of the version from
+func storageVersionKind(version string) string {
+	files, _ := filepath.Glob(filepath.Join("pkg", "apis", filepath.FromSlash(version), "*.go"))
+	kinds := []string{}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			klog.Fatalf("could not read %s: %v", f, err)
+		}
+		for _, m := range resourceMethod.FindAllStringSubmatch(string(b), -1) {
+			kinds = append(kinds, m[1])
+		}
+	}
+	if len(kinds) == 0 {
+		klog.Fatalf("--storage-version %q has no resources under pkg/apis/%s", version, version)
+	}
+	sort.Strings(kinds)
+	return kinds[0]
+}
+
+var storageVersionsTemplate = `// Code generated by apiserver-boot build executables --storage-version. DO NOT EDIT.
+
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
+{{ range $alias, $path := .Imports }}
+	{{ $alias }} "{{ $path }}"
+{{- end }}
+)
+
+// storageScheme has the resources of the apiserver for encoding the objects written to etcd
+var storageScheme = runtime.NewScheme()
+
+func init() {
+	builder.APIServer.WithAdditionalSchemesToBuild(storageScheme).WithOptionsFns(setStorageVersions)
+}
+
+// storageVersions are a resource of each --storage-version, the version the objects of its
+// API group are written to etcd in
+var storageVersions = []resource.Object{
+{{- range .Versions }}
+	// {{ .Path }}
+	&{{ .Alias }}.{{ .Kind }}{},
+{{- end }}
+}
+
+// setStorageVersions encodes the objects of the API groups of the storageVersions in these versions.
+// The objects of the other API groups are encoded in the version they would be otherwise.
+func setStorageVersions(o *builder.ServerOptions) *builder.ServerOptions {
+	if o.RecommendedOptions.Etcd == nil {
+		return o
+	}
+	versions := schema.GroupVersions{}
+	for _, obj := range storageVersions {
+		versions = append(versions, obj.GetGroupVersionResource().GroupVersion())
+	}
+	if gvs, ok := o.RecommendedOptions.Etcd.StorageConfig.EncodeVersioner.(schema.GroupVersions); ok {
+		versions = append(versions, gvs...)
+	}
+	o.RecommendedOptions.Etcd.StorageConfig.EncodeVersioner = versions
+	o.RecommendedOptions.Etcd.StorageConfig.Codec = serializer.NewCodecFactory(storageScheme).LegacyCodec(versions...)
+	return o
+}
+`
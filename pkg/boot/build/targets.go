@@ -0,0 +1,346 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// buildTarget is a binary built from a main package under cmd/
+type buildTarget struct {
+	// Name is the name of the target in --targets
+	Name string
+	// Dir is the directory containing the main.go of the target
+	Dir string
+	// Binary is the default file name of the built binary
+	Binary string
+	// Group is the API group served by the binary, empty if it serves all groups
+	Group string
+	// KeepCgoEnv is true if a CGO_ENABLED already in the environment is left as is
+	KeepCgoEnv bool
+	// Optional is true if the target is skipped when its main.go doesn't exist
+	Optional bool
+	// Test is true if the target is the test binaries of the packages under Dir, built with
+	// go test -c into the directory Binary.  Only Test targets are built with --race.
+	Test bool
+}
+
+var builtinTargets = []buildTarget{
+	{
+		Name:   apiserverTarget,
+		Dir:    filepath.Join("cmd", "apiserver"),
+		Binary: "apiserver",
+	},
+	{
+		Name:       controllerTarget,
+		Dir:        filepath.Join("cmd", "manager"),
+		Binary:     "controller-manager",
+		KeepCgoEnv: true,
+	},
+	{
+		Name:     migrateTarget,
+		Dir:      filepath.Join("cmd", "migrate"),
+		Binary:   "migrate",
+		Optional: true,
+	},
+	{
+		Name:     kubectlPlugin,
+		Dir:      filepath.Join("cmd", "kubectl-plugin"),
+		Binary:   "kubectl-plugin",
+		Optional: true,
+	},
+	{
+		Name:   testTarget,
+		Dir:    "pkg",
+		Binary: "tests",
+		Test:   true,
+	},
+}
+
+// validTargets describes the values accepted by --targets
+var validTargets = []string{apiserverTarget, controllerTarget, migrateTarget, kubectlPlugin, testTarget, apiserverTarget + ":<group>"}
+
+// buildOrder lists the targets in the order they are built, before the targets it doesn't list
+var buildOrder []string
+
+// resolveTargets returns the targets selected by BuildTargets in the order they are listed,
+// or in the --order if it is set.  Entries may be comma separated.  apiserver:<group> selects
+// an apiserver for a single API group built from cmd/apiserver-<group>.  Names which aren't
+// targets and optional targets without a main.go are ignored.
+func resolveTargets() []buildTarget {
+	targets := []buildTarget{}
+	seen := map[string]bool{}
+	for _, entry := range BuildTargets {
+		for _, name := range strings.Split(entry, ",") {
+			name = strings.TrimSpace(name)
+			t, found := lookupTarget(name)
+			if !found || seen[t.Name] || (t.Optional && !targetPresent(t)) {
+				continue
+			}
+			seen[t.Name] = true
+			targets = append(targets, t)
+		}
+	}
+	return orderTargets(targets)
+}
+
+// absentTargets returns the optional targets selected by BuildTargets which are skipped
+// because their main.go doesn't exist
+func absentTargets() []buildTarget {
+	absent := []buildTarget{}
+	for _, entry := range BuildTargets {
+		for _, name := range strings.Split(entry, ",") {
+			if t, found := lookupTarget(strings.TrimSpace(name)); found && t.Optional && !targetPresent(t) {
+				absent = append(absent, t)
+			}
+		}
+	}
+	return absent
+}
+
+// targetPresent returns true if the main.go of target t exists, or the directory of a Test target
+func targetPresent(t buildTarget) bool {
+	if t.Test {
+		info, err := os.Stat(t.Dir)
+		return err == nil && info.IsDir()
+	}
+	_, err := os.Stat(filepath.Join(t.Dir, "main.go"))
+	return err == nil
+}
+
+// orderTargets moves the targets listed in --order to the front in that order
+func orderTargets(targets []buildTarget) []buildTarget {
+	if len(buildOrder) == 0 {
+		return targets
+	}
+	rank := map[string]int{}
+	for i, name := range buildOrder {
+		if _, found := lookupTarget(name); !found {
+			klog.Fatalf("--order %q is not a target, valid targets are %q", name, validTargets)
+		}
+		if _, found := rank[name]; found {
+			klog.Fatalf("--order lists %q more than once", name)
+		}
+		rank[name] = i
+	}
+	ordered := []buildTarget{}
+	for _, name := range buildOrder {
+		for _, t := range targets {
+			if t.Name == name {
+				ordered = append(ordered, t)
+			}
+		}
+	}
+	for _, t := range targets {
+		if _, found := rank[t.Name]; !found {
+			ordered = append(ordered, t)
+		}
+	}
+	return ordered
+}
+
+// readTargets replaces a - entry of BuildTargets with the target names read from r
+func readTargets(r io.Reader) error {
+	targets := []string{}
+	read := false
+	for _, entry := range BuildTargets {
+		for _, name := range strings.Split(entry, ",") {
+			if strings.TrimSpace(name) != "-" {
+				targets = append(targets, name)
+				continue
+			}
+			if read {
+				continue
+			}
+			read = true
+			names, err := scanTargets(r)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, names...)
+		}
+	}
+	BuildTargets = targets
+	return nil
+}
+
+// scanTargets returns the newline separated target names read from r
+func scanTargets(r io.Reader) ([]string, error) {
+	names := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read --targets from stdin: %v", err)
+	}
+	return names, nil
+}
+
+// lookupTarget returns the target called name
+func lookupTarget(name string) (buildTarget, bool) {
+	for _, t := range builtinTargets {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	if group := strings.TrimPrefix(name, apiserverTarget+":"); group != name && len(group) > 0 {
+		return buildTarget{
+			Name:   name,
+			Dir:    filepath.Join("cmd", "apiserver-"+group),
+			Binary: "apiserver-" + group,
+			Group:  group,
+		}, true
+	}
+	return buildTarget{}, false
+}
+
+// TargetsSelected returns true if BuildTargets contains at least one buildable target
+func TargetsSelected() bool {
+	return len(resolveTargets()) > 0
+}
+
+// targetGroups returns the API groups the selected targets are scoped to, or nil if any
+// selected apiserver serves all groups
+func targetGroups() []string {
+	groups := []string{}
+	for _, t := range resolveTargets() {
+		switch {
+		case t.Name == apiserverTarget:
+			return nil
+		case len(t.Group) > 0:
+			groups = append(groups, t.Group)
+		}
+	}
+	return groups
+}
+
+// isApiserverTarget returns true if the target called name is an apiserver
+func isApiserverTarget(name string) bool {
+	return name == apiserverTarget || strings.HasPrefix(name, apiserverTarget+":")
+}
+
+func buildApiserver() bool {
+	return selected(apiserverTarget)
+}
+
+func buildController() bool {
+	return selected(controllerTarget)
+}
+
+func buildMigrate() bool {
+	return selected(migrateTarget)
+}
+
+func selected(name string) bool {
+	for _, t := range resolveTargets() {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// platform is a GOOS and GOARCH to build for.  Empty values build for the host.
+type platform struct {
+	OS   string
+	Arch string
+}
+
+// buildPlatforms returns the platforms from --platforms, or the platform from --goos
+// and --goarch if --platforms isn't set
+func buildPlatforms() []platform {
+	if len(platforms) == 0 {
+		return []platform{{OS: goos, Arch: goarch}}
+	}
+	result := []platform{}
+	for _, p := range platforms {
+		parts := strings.Split(p, "/")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			klog.Fatalf("--platforms entry %q must be of the form os/arch", p)
+		}
+		result = append(result, platform{OS: parts[0], Arch: parts[1]})
+	}
+	return result
+}
+
+// platformDir returns the directory under the output directory the binaries for the
+// current platform are written to
+func platformDir() string {
+	if len(platforms) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s_%s", targetOS(), targetArch())
+}
+
+// targetDir returns the directory under the output directory the binaries of target t for the
+// current platform are written to, rendered from --output-template if it is set
+func targetDir(t buildTarget) string {
+	if len(outputTemplate) == 0 {
+		return platformDir()
+	}
+	rendered := renderTemplate("output-template", outputTemplate, t.Binary)
+	dir := filepath.Clean(filepath.FromSlash(rendered))
+	if len(rendered) == 0 || !insideDir(dir) {
+		klog.Fatalf("--output-template %q must render to a relative directory inside --output, got %q", outputTemplate, rendered)
+	}
+	return dir
+}
+
+// insideDir returns true if the clean path dir is relative and doesn't leave the directory it is
+// relative to
+func insideDir(dir string) bool {
+	return !filepath.IsAbs(dir) && filepath.VolumeName(dir) == "" &&
+		dir != ".." && !strings.HasPrefix(dir, ".."+string(filepath.Separator))
+}
+
+// checkOutputPaths exits if the binaries of two targets or platforms would be written to the
+// same path, e.g. with an --output-template or --name-template without {{.OS}} and {{.Arch}}
+func checkOutputPaths() {
+	prevOS, prevArch := goos, goarch
+	defer func() { goos, goarch = prevOS, prevArch }()
+	written := map[string]string{}
+	for _, p := range buildPlatforms() {
+		goos, goarch = p.OS, p.Arch
+		for _, t := range resolveTargets() {
+			output := filepath.Join(targetDir(t), outputName(t))
+			name := t.Name + platformSuffix()
+			if other, found := written[output]; found {
+				klog.Fatalf("%s and %s would both be written to %s, use {{.Target}}, {{.OS}} and {{.Arch}} "+
+					"in --output-template or --name-template to write them to different paths", other, name, filepath.Join(outputdir, output))
+			}
+			written[output] = name
+		}
+	}
+}
+
+// platformSuffix returns the current platform for messages about a target
+func platformSuffix() string {
+	if len(platforms) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s/%s)", targetOS(), targetArch())
+}
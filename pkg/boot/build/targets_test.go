@@ -0,0 +1,58 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestDefaultTargets(t *testing.T) {
+	root := &cobra.Command{Use: "apiserver-boot"}
+	AddBuild(root)
+
+	tests := []struct {
+		command string
+		targets *[]string
+		want    []string
+	}{
+		{
+			command: "executables",
+			targets: &BuildTargets,
+			want:    []string{apiserverTarget, controllerTarget, migrateTarget, kubectlPlugin},
+		},
+		{
+			command: "container",
+			targets: &containerTargets,
+			want:    []string{apiserverTarget, controllerTarget, migrateTarget},
+		},
+	}
+	for _, test := range tests {
+		cmd, _, err := root.Find([]string{"build", test.command})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.ParseFlags(nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := *test.targets; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("build %s --targets defaults to %v, want %v", test.command, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+var keepTemp bool
+var buildDir string
+
+// tempDirs are the directories created by tempDir which haven't been removed yet
+var tempDirs = map[string]bool{}
+var tempDirsLock sync.Mutex
+
+// useBuildDir points the temporary directories of the build, and of go, and GOCACHE under --build-dir
+func useBuildDir() {
+	if len(buildDir) == 0 {
+		return
+	}
+	abs, err := filepath.Abs(buildDir)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	buildDir = abs
+	if err := os.MkdirAll(filepath.Join(buildDir, "tmp"), 0755); err != nil {
+		klog.Fatalf("could not create --build-dir %s: %v", buildDir, err)
+	}
+	// inherited by every go command run by the build
+	os.Setenv("GOTMPDIR", filepath.Join(buildDir, "tmp"))
+	os.Setenv("GOCACHE", filepath.Join(buildDir, "go-build"))
+}
+
+// tempDir creates a new temporary directory like ioutil.TempDir, printing its location with --keep-temp.
+// The directories of the default temporary directory are created under --build-dir if it is set.
+func tempDir(dir, pattern string) (string, error) {
+	if len(buildDir) > 0 && (len(dir) == 0 || dir == os.TempDir()) {
+		dir = filepath.Join(buildDir, "tmp")
+	}
+	name, err := ioutil.TempDir(dir, pattern)
+	if err == nil && keepTemp {
+		klog.Infof("--keep-temp: keeping the temporary directory %s", name)
+	}
+	if err == nil {
+		tempDirsLock.Lock()
+		tempDirs[name] = true
+		tempDirsLock.Unlock()
+	}
+	return name, err
+}
+
+// removeTempDir removes a directory created by tempDir unless --keep-temp is set
+func removeTempDir(name string) {
+	if keepTemp {
+		return
+	}
+	tempDirsLock.Lock()
+	delete(tempDirs, name)
+	tempDirsLock.Unlock()
+	// not removeAll, the directory was created by tempDir, so removing it can't remove the files of
+	// a symlinked directory the user placed in the path
+	os.RemoveAll(name)
+}
+
+// removeTempDirs removes the directories created by tempDir which haven't been removed yet,
+// unless --keep-temp is set
+func removeTempDirs() {
+	if keepTemp {
+		return
+	}
+	tempDirsLock.Lock()
+	defer tempDirsLock.Unlock()
+	for name := range tempDirs {
+		// created by tempDir, as in removeTempDir
+		os.RemoveAll(name)
+	}
+}
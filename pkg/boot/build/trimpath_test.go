@@ -0,0 +1,130 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeModuleProxy writes a GOPROXY directory serving example.com/dep@v1.0.0
+func writeModuleProxy(t *testing.T, dir string) {
+	base := filepath.Join(dir, "example.com", "dep", "@v")
+	if err := os.MkdirAll(base, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gomod := "module example.com/dep\n"
+	files := map[string]string{
+		"list":        "v1.0.0\n",
+		"v1.0.0.info": `{"Version":"v1.0.0","Time":"2022-01-01T00:00:00Z"}`,
+		"v1.0.0.mod":  gomod,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(base, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	for name, content := range map[string]string{
+		"go.mod": gomod,
+		"dep.go": "package dep\n\nfunc Name() string { return \"dep\" }\n",
+	} {
+		w, err := z.Create("example.com/dep@v1.0.0/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(base, "v1.0.0.zip"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeFiles writes the files of names to contents into dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// buildProgram builds the main package in src to output with goBuildCommand and the extra
+// environment env, returning the binary
+func buildProgram(t *testing.T, src, output string, env []string) []byte {
+	c := goBuildCommand(context.Background(), buildTarget{Name: "app", Dir: "."}, output, env)
+	c.Dir = src
+	if out, err := c.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	b, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// buildWithModCache builds a program depending on example.com/dep from its own source
+// directory, module cache and build cache under dir
+func buildWithModCache(t *testing.T, dir, proxy string) []byte {
+	src := filepath.Join(dir, "src")
+	writeFiles(t, src, map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.17\n\nrequire example.com/dep v1.0.0\n",
+		"main.go": "package main\n\nimport \"example.com/dep\"\n\nfunc main() { println(dep.Name()) }\n",
+	})
+	return buildProgram(t, src, filepath.Join(dir, "app"), []string{
+		"GOPROXY=file://" + filepath.ToSlash(proxy),
+		"GOSUMDB=off",
+		"GOMODCACHE=" + filepath.Join(dir, "modcache"),
+		"GOCACHE=" + filepath.Join(dir, "cache"),
+	})
+}
+
+func TestTrimpathReproducible(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary twice")
+	}
+	defer func(old bool) { trimpath = old }(trimpath)
+	trimpath = true
+	// -modcacherw lets the test remove the module caches
+	t.Setenv("GOFLAGS", "-mod=mod -modcacherw")
+
+	dir := t.TempDir()
+	proxy := filepath.Join(dir, "proxy")
+	writeModuleProxy(t, proxy)
+
+	first := buildWithModCache(t, filepath.Join(dir, "first"), proxy)
+	second := buildWithModCache(t, filepath.Join(dir, "second", "other"), proxy)
+	if !bytes.Equal(first, second) {
+		t.Errorf("binaries built with -trimpath from different GOMODCACHE paths differ")
+	}
+	if bytes.Contains(first, []byte(dir)) {
+		t.Errorf("binary built with -trimpath contains the build path %s", dir)
+	}
+}
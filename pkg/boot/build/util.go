@@ -17,10 +17,15 @@ limitations under the License.
 package build
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"strings"
 
 	"k8s.io/klog/v2"
 )
@@ -28,6 +33,9 @@ import (
 var versionedAPIs []string
 var unversionedAPIs []string
 var vendorDir string
+var version string
+var sourceVersion string
+var relativePaths bool
 
 func initApis() {
 	if len(versionedAPIs) == 0 {
@@ -35,7 +43,18 @@ func initApis() {
 		if err != nil {
 			klog.Fatalf("could not read pkg/apis directory to find api Versions")
 		}
+		// only generate for the API groups of the apiserver targets if they are scoped to groups
+		scope := map[string]bool{}
+		for _, g := range targetGroups() {
+			if _, err := os.Stat(filepath.Join("pkg", "apis", g)); err != nil {
+				klog.Fatalf("could not find API group %s under pkg/apis for target %s:%s", g, apiserverTarget, g)
+			}
+			scope[g] = true
+		}
 		for _, g := range groups {
+			if len(scope) > 0 && !scope[g.Name()] {
+				continue
+			}
 			if g.IsDir() {
 				versionFiles, err := ioutil.ReadDir(filepath.Join("pkg", "apis", g.Name()))
 				if err != nil {
@@ -57,4 +76,185 @@ func initApis() {
 	for a := range u {
 		unversionedAPIs = append(unversionedAPIs, a)
 	}
+
+	if withProto {
+		generateProto()
+	}
+	if withCRDs {
+		generateCRDs()
+	}
+	if verifyGenerated {
+		checkGenerated()
+	}
+	if withConversionFuzz {
+		runConversionFuzz()
+	}
+	if verifyScheme {
+		runSchemeCheck()
+	}
+	if len(aggregationRoutes) > 0 {
+		generateAggregationRoutes()
+	}
+	removeUnwritten(aggregationRoutesFile, "aggregation-routes")
+	if len(storageVersions) > 0 {
+		generateStorageVersions()
+	}
+	removeUnwritten(storageVersionsFile, "storage-version")
+	if len(defaultAdmission) > 0 {
+		generateDefaultAdmission()
+	}
+	removeUnwritten(defaultAdmissionFile, "default-admission")
+	if verifyOpenAPI {
+		generateOpenAPICheck()
+	}
+	// the --validate-openapi mode switches off the authorization of the apiserver
+	removeUnwritten(openAPICheckFile, "verify-openapi")
+}
+
+// projectVersion returns the version of the project being built from --source-version or git describe
+func projectVersion() string {
+	if len(version) == 0 && len(sourceVersion) > 0 {
+		version = sourceVersion
+	}
+	if len(version) == 0 {
+		out, err := exec.Command("git", "describe", "--tags", "--always", "--dirty").Output()
+		if err != nil {
+			klog.Warningf("could not determine the project version with git describe, "+
+				"use --source-version to build outside of a git working tree: %v", err)
+			version = "unknown"
+		} else {
+			version = strings.TrimSpace(string(out))
+		}
+	}
+	return version
+}
+
+// targetOS returns the GOOS the binaries are built for
+func targetOS() string {
+	if len(goos) > 0 {
+		return goos
+	}
+	if e := os.Getenv("GOOS"); len(e) > 0 {
+		return e
+	}
+	return runtime.GOOS
+}
+
+// targetArch returns the GOARCH the binaries are built for
+func targetArch() string {
+	if len(goarch) > 0 {
+		return goarch
+	}
+	if e := os.Getenv("GOARCH"); len(e) > 0 {
+		return e
+	}
+	return runtime.GOARCH
+}
+
+// checkCleanWorkingTree exits if the git working tree has uncommitted changes
+func checkCleanWorkingTree() {
+	if err := exec.Command("git", "rev-parse", "--is-inside-work-tree").Run(); err != nil {
+		klog.Warningf("--require-clean has no effect outside of a git working tree")
+		return
+	}
+	out, err := exec.Command("git", "status", "--porcelain").Output()
+	if err != nil {
+		klog.Fatalf("could not get the git working tree status: %v", err)
+	}
+	if changes := strings.TrimSpace(string(out)); len(changes) > 0 {
+		klog.Fatalf("--require-clean: git working tree has uncommitted changes:\n%s", changes)
+	}
+}
+
+// changedDirs returns the existing directories containing files which changed since the git ref
+func changedDirs(ref string) ([]string, error) {
+	out, err := exec.Command("git", "diff", "--name-only", "--relative", ref, "--").Output()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	dirs := []string{}
+	for _, f := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if len(f) == 0 {
+			continue
+		}
+		dir := filepath.Dir(filepath.FromSlash(f))
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
+// projectRoot returns the closest directory containing a go.mod, starting from the working directory
+func projectRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("could not find a go.mod in the working directory or its parents")
+		}
+		dir = parent
+	}
+}
+
+// resolveOutputDir makes a relative --output relative to the directory selected by --output-base
+func resolveOutputDir() {
+	switch outputBase {
+	case "cwd":
+	case "project-root":
+		if filepath.IsAbs(outputdir) {
+			return
+		}
+		root, err := projectRoot()
+		if err != nil {
+			klog.Fatalf("--output-base project-root: %v", err)
+		}
+		outputdir = filepath.Join(root, outputdir)
+	default:
+		klog.Fatalf("--output-base must be cwd or project-root, got %q", outputBase)
+	}
+}
+
+// displayPath returns path relative to the project root for logs and json output with
+// --relative-paths.  Paths outside of the project root are returned as is.
+func displayPath(path string) string {
+	if !relativePaths {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// displayArgs returns the command line args with the absolute paths replaced by their displayPath
+func displayArgs(args []string) []string {
+	display := make([]string, 0, len(args))
+	for _, a := range args {
+		if filepath.IsAbs(a) {
+			a = displayPath(a)
+		}
+		display = append(display, a)
+	}
+	return display
 }
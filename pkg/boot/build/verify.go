@@ -0,0 +1,67 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var smokeTest bool
+var smokeTestArgs []string
+
+// smokeTestTimeout bounds how long a built apiserver may run for the smoke test
+const smokeTestTimeout = time.Minute
+
+// runSmokeTests runs the built apiservers with --smoke-test-args and fails if they don't exit
+// cleanly, catching crashes during initialization which compile fine
+func runSmokeTests() {
+	for _, a := range artifacts {
+		if !isApiserverTarget(a.Target) {
+			continue
+		}
+		if a.OS != runtime.GOOS || a.Arch != runtime.GOARCH {
+			klog.Warningf("Skipping --smoke-test of %s, binaries built for %s/%s can't run on %s/%s",
+				a.Path, a.OS, a.Arch, runtime.GOOS, runtime.GOARCH)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), smokeTestTimeout)
+		bin, err := filepath.Abs(a.Path)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		c := exec.CommandContext(ctx, bin, smokeTestArgs...)
+		klog.Infof("%s", strings.Join(c.Args, " "))
+		c.Stderr = util.Stderr
+		c.Stdout = util.Stdout
+		err = c.Run()
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded {
+			klog.Fatalf("--smoke-test: %s did not exit within %v", a.Path, smokeTestTimeout)
+		}
+		if err != nil {
+			klog.Fatalf("--smoke-test: %s failed: %v", a.Path, err)
+		}
+	}
+}
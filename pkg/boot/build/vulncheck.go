@@ -0,0 +1,153 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
+)
+
+var vulncheck bool
+var vulncheckThreshold string
+
+// vulncheckLevels are the --vulncheck-threshold values from the most to the least severe finding.
+// A vulnerable function is called, a vulnerable package is imported or a vulnerable module is required.
+var vulncheckLevels = []string{"called", "imported", "required"}
+
+// vulncheckLevel returns the index of level in vulncheckLevels or -1
+func vulncheckLevel(level string) int {
+	for i, l := range vulncheckLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// vulncheckFinding is the part of a govulncheck -json finding message used to report it
+type vulncheckFinding struct {
+	OSV          string `json:"osv"`
+	FixedVersion string `json:"fixed_version"`
+	Trace        []struct {
+		Module   string `json:"module"`
+		Version  string `json:"version"`
+		Package  string `json:"package"`
+		Function string `json:"function"`
+	} `json:"trace"`
+}
+
+// level returns the vulncheckLevels entry of the finding
+func (f vulncheckFinding) level() string {
+	if len(f.Trace) == 0 || len(f.Trace[0].Package) == 0 {
+		return "required"
+	}
+	if len(f.Trace[0].Function) == 0 {
+		return "imported"
+	}
+	return "called"
+}
+
+// runVulncheck runs govulncheck on the packages of the targets and exits if it finds a
+// vulnerability at or above --vulncheck-threshold.  It warns and returns if govulncheck
+// isn't installed.
+func runVulncheck() {
+	threshold := vulncheckLevel(vulncheckThreshold)
+	if threshold < 0 {
+		klog.Fatalf("--vulncheck-threshold must be one of %q, got %q", vulncheckLevels, vulncheckThreshold)
+	}
+	path, err := exec.LookPath("govulncheck")
+	if err != nil {
+		klog.Warningf("skipping --vulncheck, govulncheck isn't installed.  "+
+			"Install it with `%s install golang.org/x/vuln/cmd/govulncheck@latest`", goBinary())
+		return
+	}
+
+	c := exec.Command(path, append([]string{"-json"}, vulncheckPackages()...)...)
+	out := &bytes.Buffer{}
+	c.Stdout = out
+	c.Stderr = util.Stderr
+	klog.Infof("%s", strings.Join(c.Args, " "))
+	if err := c.Run(); err != nil {
+		klog.Fatalf("govulncheck failed: %v", err)
+	}
+	findings, err := parseVulncheck(out)
+	if err != nil {
+		klog.Fatalf("could not read the govulncheck output: %v", err)
+	}
+
+	failed := []string{}
+	for _, f := range findings {
+		if vulncheckLevel(f.level()) > threshold {
+			continue
+		}
+		msg := fmt.Sprintf("%s (%s %s)", f.OSV, f.level(), f.Trace[0].Module)
+		if len(f.FixedVersion) > 0 {
+			msg += " fixed in " + f.FixedVersion
+		}
+		failed = append(failed, msg)
+	}
+	if len(failed) > 0 {
+		klog.Fatalf("--vulncheck found vulnerabilities:\n%s", strings.Join(failed, "\n"))
+	}
+}
+
+// parseVulncheck returns the findings from the govulncheck -json message stream, one per
+// vulnerability and level
+func parseVulncheck(r io.Reader) ([]vulncheckFinding, error) {
+	findings := []vulncheckFinding{}
+	seen := map[string]bool{}
+	d := json.NewDecoder(r)
+	for d.More() {
+		msg := struct {
+			Finding *vulncheckFinding `json:"finding"`
+		}{}
+		if err := d.Decode(&msg); err != nil {
+			return nil, err
+		}
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 {
+			continue
+		}
+		key := msg.Finding.OSV + " " + msg.Finding.level()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		findings = append(findings, *msg.Finding)
+	}
+	return findings, nil
+}
+
+// vulncheckPackages returns the packages govulncheck checks, the main packages of the targets
+// or the --plugin-package
+func vulncheckPackages() []string {
+	if buildMode == "plugin" {
+		return []string{pluginPackage}
+	}
+	pkgs := []string{}
+	for _, t := range resolveTargets() {
+		pkgs = append(pkgs, "./"+filepath.ToSlash(t.Dir))
+	}
+	return pkgs
+}
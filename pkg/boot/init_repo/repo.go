@@ -117,7 +117,12 @@ func createApiserver(boilerplate string) {
 			boilerplate,
 			util.GetRepo(),
 		})
-
+	util.WriteIfNotFound(filepath.Join(dir, "cmd", "apiserver", "pprof.go"), "pprof-template", pprofTemplate,
+		apiserverTemplateArguments{
+			domain,
+			boilerplate,
+			util.GetRepo(),
+		})
 }
 
 func createPackage(boilerplate, path, goGenerateCommand string) {
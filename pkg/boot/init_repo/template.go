@@ -7,6 +7,8 @@ var (
 	goModTemplate string
 	//go:embed templates/apiserver.tpl
 	apiserverTemplate string
+	//go:embed templates/pprof.tpl
+	pprofTemplate string
 	//go:embed templates/api.doc.tpl
 	apisDocTemplate string
 	//go:embed templates/package.doc.tpl
@@ -0,0 +1,29 @@
+//go:build pprof
+
+{{.BoilerPlate}}
+
+package main
+
+// This file is only built with `apiserver-boot build executables --with-pprof`.  The profiling
+// endpoints expose the memory, goroutine stacks and command line of the apiserver without
+// authentication, so don't build production images with it, and keep PPROF_ADDRESS on an
+// address which isn't reachable from outside the pod.
+
+import (
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+
+	"k8s.io/klog"
+)
+
+func init() {
+	addr := os.Getenv("PPROF_ADDRESS")
+	if len(addr) == 0 {
+		addr = "localhost:6060"
+	}
+	go func() {
+		klog.Infof("Serving pprof on http://%s/debug/pprof/", addr)
+		klog.Error(http.ListenAndServe(addr, nil))
+	}()
+}
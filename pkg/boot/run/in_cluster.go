@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/build"
 	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/util"
@@ -33,6 +34,12 @@ var runInClusterCmd = &cobra.Command{
 # Build a new image and run the apiserver and controller-manager in the cluster
 apiserver-boot run in-cluster --name example --namespace default --image gcr.io/myrepo/myimage:mytag
 
+# Also sign the pushed image with the notation key called release
+apiserver-boot run in-cluster --name example --namespace default --image gcr.io/myrepo/myimage:mytag --notation-key release
+
+# Sign the pushed image with both cosign and notation
+apiserver-boot run in-cluster --name example --namespace default --image gcr.io/myrepo/myimage:mytag --sign --cosign-key cosign.key --notation-key release
+
 # Clear the discovery cache for kubectl
 rm -rf ~/.kube/cache/discovery/
 
@@ -53,6 +60,8 @@ func AddInCluster(cmd *cobra.Command) {
 	cmd.AddCommand(runInClusterCmd)
 
 	build.AddBuildResourceConfigFlags(runInClusterCmd)
+	build.AddSignFlags(runInClusterCmd)
+	build.AddDistrolessVariantFlag(runInClusterCmd)
 	runInClusterCmd.Flags().BoolVar(&buildImage, "build-image", true, "if true, build the container image.")
 	runInClusterCmd.Flags().BoolVar(&buildImage, "push-image", true, "if true, push it to the image repo.")
 }
@@ -62,9 +71,13 @@ func RunInCluster(cmd *cobra.Command, args []string) {
 		// Build the container first
 		build.RunBuildContainer(cmd, args)
 
-		// Push the image
-		if pushImage {
+		// Push the image, which signing it requires
+		if pushImage || build.Signing() {
+			if build.DistrolessDebug() {
+				klog.Warningf("pushing %s built from the distroless debug variant, which has a shell.  Use it for troubleshooting only.", build.Image)
+			}
 			util.DoCmd("docker", "push", build.Image)
+			build.SignImage(build.Image)
 		}
 	}
 
@@ -97,7 +97,9 @@ func AddLocal(cmd *cobra.Command) {
 func RunLocal(cmd *cobra.Command, args []string) {
 	if buildBin {
 		build.BuildTargets = toRun
-		build.RunBuildExecutables(cmd, args)
+		if build.TargetsSelected() {
+			build.RunBuildExecutables(cmd, args)
+		}
 	}
 
 	WriteKubeConfig()
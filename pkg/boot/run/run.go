@@ -18,6 +18,8 @@ package run
 
 import (
 	"github.com/spf13/cobra"
+
+	"sigs.k8s.io/apiserver-builder-alpha/pkg/boot/build"
 )
 
 var runCmd = &cobra.Command{
@@ -38,7 +40,8 @@ rm -rf ~/.kube/cache/discovery/
 
 # Check the api versions of the remotely running server
 kubectl api-versions`,
-	Run: RunRun,
+	PersistentPreRun: build.SetupLogs,
+	Run:              RunRun,
 }
 
 func AddRun(cmd *cobra.Command) {
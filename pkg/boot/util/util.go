@@ -19,6 +19,7 @@ package util
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -34,6 +35,10 @@ import (
 
 var Domain string
 
+// Stdout and Stderr are where the output of the commands run by apiserver-boot is written
+var Stdout io.Writer = os.Stdout
+var Stderr io.Writer = os.Stderr
+
 // writeIfNotFound returns true if the file was created and false if it already exists
 func WriteIfNotFound(path, templateName, templateValue string, data interface{}) bool {
 	// Make sure the directory exists
@@ -138,8 +143,8 @@ func create(path string) {
 
 func DoCmd(cmd string, args ...string) {
 	c := exec.Command(cmd, args...)
-	c.Stderr = os.Stderr
-	c.Stdout = os.Stdout
+	c.Stderr = Stderr
+	c.Stdout = Stdout
 	klog.Infof("%s", strings.Join(c.Args, " "))
 	err := c.Run()
 	if err != nil {
@@ -0,0 +1,43 @@
+//go:build pprof
+
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This file is only built with `apiserver-boot build executables --with-pprof`.  The profiling
+// endpoints expose the memory, goroutine stacks and command line of the apiserver without
+// authentication, so don't build production images with it, and keep PPROF_ADDRESS on an
+// address which isn't reachable from outside the pod.
+
+import (
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+
+	"k8s.io/klog"
+)
+
+func init() {
+	addr := os.Getenv("PPROF_ADDRESS")
+	if len(addr) == 0 {
+		addr = "localhost:6060"
+	}
+	go func() {
+		klog.Infof("Serving pprof on http://%s/debug/pprof/", addr)
+		klog.Error(http.ListenAndServe(addr, nil))
+	}()
+}